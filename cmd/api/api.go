@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -10,15 +15,50 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/shehab910/social/internal/mailer"
 	ratelimiter "github.com/shehab910/social/internal/rate-limiter"
+	"github.com/shehab910/social/internal/realtime"
+	"github.com/shehab910/social/internal/screening"
 	"github.com/shehab910/social/internal/store"
+	"github.com/shehab910/social/internal/timeline"
 )
 
+const shutdownTimeout = 10 * time.Second
+
 type dbConfig struct {
 	addr         string
 	maxOpenConns int
 	maxIdleConns int
 	maxIdleTime  string
 	schemaName   string
+	tx           store.TxConfig
+}
+
+type suggestionsConfig struct {
+	limit           int
+	refreshInterval time.Duration
+}
+
+type schedulerConfig struct {
+	interval  time.Duration
+	batchSize int
+}
+
+type trashConfig struct {
+	retention     time.Duration
+	purgeInterval time.Duration
+}
+
+type streamConfig struct {
+	hub       realtime.Config
+	channel   string
+	heartbeat time.Duration
+	// ticketTTL is how long a stream ticket can be redeemed
+	ticketTTL           time.Duration
+	ticketPurgeInterval time.Duration
+}
+
+type moderationConfig struct {
+	// autoHideThreshold is the number of pending reports hiding a post or comment, 0 disables it
+	autoHideThreshold int
 }
 
 type config struct {
@@ -31,6 +71,17 @@ type config struct {
 	tokenExpirationMins int
 	jwtSecret           string
 	rateLimiter         ratelimiter.Config
+	fanOut              timeline.Config
+	feed                store.FeedOptions
+	suggestions         suggestionsConfig
+	scheduler           schedulerConfig
+	trash               trashConfig
+	stream              streamConfig
+	gateway             gatewayConfig
+	moderation          moderationConfig
+	screening           screeningConfig
+	export              exportConfig
+	deletion            accountDeletionConfig
 }
 
 type application struct {
@@ -38,6 +89,12 @@ type application struct {
 	store       *store.Storage
 	mailer      mailer.Client
 	rateLimiter ratelimiter.Limiter
+	fanOut      *timeline.FanOutWorker
+	hub         *realtime.Hub
+	gateway     *gateway
+	screening   *screening.Pipeline
+	// screeningRules is invalidated when admins change the rules
+	screeningRules *screening.RuleCache
 }
 
 func (app *application) mount() http.Handler {
@@ -47,13 +104,12 @@ func (app *application) mount() http.Handler {
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(time.Minute))
 
 	r.Use(cors.Handler(cors.Options{
 		// AllowedOrigins: []string{env.GetString("CORS_ALLOWED_ORIGIN", "http://127.0.0.1:5173/*")}, // Use this to allow specific origin hosts
 		AllowedOrigins: []string{"https://*", "http://*"},
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: false,
@@ -66,60 +122,193 @@ func (app *application) mount() http.Handler {
 	}
 
 	r.Route("/v1", func(r chi.Router) {
-		r.Get("/health", app.healthCheckHandler)
+		// long lived connections are left out of the request timeout
+		r.Group(func(r chi.Router) {
+			r.Use(app.streamTicketMiddleware)
+
+			r.Get("/stream", app.streamHandler)
+			r.Get("/ws", app.gatewayHandler)
+		})
+
+		// the export streams the whole log, a timeout would cut it short
+		r.Group(func(r chi.Router) {
+			r.Use(app.AuthenticateMiddleware)
+			r.Use(app.requireRoleMiddleware(store.RoleAdmin))
+
+			r.Get("/admin/audit/export", app.exportAuditLogHandler)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Timeout(time.Minute))
 
-		r.Route("/posts", func(r chi.Router) {
-			r.With(app.AuthenticateMiddleware).Post("/", app.createPostHandler)
+			r.Get("/health", app.healthCheckHandler)
 
-			r.Route("/{post_id}", func(r chi.Router) {
-				r.Use(app.postContextMiddleware)
+			r.With(app.AuthenticateMiddleware).Post("/stream/tickets", app.createStreamTicketHandler)
+
+			r.Route("/posts", func(r chi.Router) {
+				r.With(app.AuthenticateMiddleware).Post("/", app.createPostHandler)
+
+				r.Route("/{post_id}", func(r chi.Router) {
+					// trashed posts are not found by postContextMiddleware
+					r.With(app.AuthenticateMiddleware).Post("/restore", app.restorePostHandler)
+
+					r.Group(func(r chi.Router) {
+						r.Use(app.OptionalAuthenticateMiddleware)
+						r.Use(app.postContextMiddleware)
+
+						r.Group(func(r chi.Router) {
+							r.Use(app.AuthenticateMiddleware)
+							r.Delete("/", app.deletePostHandler)
+							r.Patch("/", app.updatePostHandler)
+							r.Post("/publish", app.publishPostHandler)
+							r.Put("/schedule", app.schedulePostHandler)
+							r.Post("/revisions/{revision}/restore", app.restorePostRevisionHandler)
+						})
+						r.Get("/", app.getPostHandler)
+						r.Get("/revisions", app.getPostRevisionsHandler)
+
+						r.Route("/comments", func(r chi.Router) {
+							r.With(app.AuthenticateMiddleware).Post("/", app.createPostCommentHandler)
+							r.Get("/", app.getPostCommentsHandler)
+						})
+					})
+				})
+			})
+
+			r.Route("/users", func(r chi.Router) {
+				r.With(app.OptionalAuthenticateMiddleware).Get("/explore", app.getExploreHandler)
 
 				r.Group(func(r chi.Router) {
 					r.Use(app.AuthenticateMiddleware)
-					r.Delete("/", app.deletePostHandler)
-					r.Patch("/", app.updatePostHandler)
+
+					r.Get("/feed", app.getUserFeedHandler)
+
+					r.Route("/me", func(r chi.Router) {
+						r.Get("/", app.getMeHandler)
+						r.Delete("/", app.deleteAccountHandler)
+						r.Patch("/settings", app.updateSettingsHandler)
+						r.Post("/export", app.requestExportHandler)
+						r.Get("/drafts", app.getDraftsHandler)
+						r.Get("/trash", app.getTrashHandler)
+						r.Get("/mentions", app.getMentionsHandler)
+
+						r.Route("/notifications", func(r chi.Router) {
+							r.Get("/", app.getNotificationsHandler)
+							r.Get("/unread-count", app.getUnreadNotificationsCountHandler)
+							r.Put("/read", app.markAllNotificationsReadHandler)
+							r.Put("/{notification_id}/read", app.markNotificationReadHandler)
+						})
+
+						r.Route("/follow-requests", func(r chi.Router) {
+							r.Get("/", app.getFollowRequestsHandler)
+							r.Put("/{requester_id}/accept", app.acceptFollowRequestHandler)
+							r.Put("/{requester_id}/decline", app.declineFollowRequestHandler)
+						})
+
+						r.Get("/tags", app.getFollowedTagsHandler)
+						r.Put("/tags/{tag}", app.followTagHandler)
+						r.Delete("/tags/{tag}", app.unfollowTagHandler)
+
+						r.Get("/blocks", app.getBlockedUsersHandler)
+						r.Get("/suggestions", app.getSuggestionsHandler)
+
+						r.Route("/mutes", func(r chi.Router) {
+							r.Get("/", app.getMutesHandler)
+							r.Put("/words/{term}", app.muteTermHandler(store.MuteKindWord))
+							r.Delete("/words/{term}", app.unmuteTermHandler(store.MuteKindWord))
+							r.Put("/tags/{term}", app.muteTermHandler(store.MuteKindTag))
+							r.Delete("/tags/{term}", app.unmuteTermHandler(store.MuteKindTag))
+							r.Put("/users/{muted_user_id}", app.muteUserHandler)
+							r.Delete("/users/{muted_user_id}", app.unmuteUserHandler)
+						})
+					})
 				})
-				r.Get("/", app.getPostHandler) // how to make this not require auth
 
-				r.Route("/comments", func(r chi.Router) {
-					r.With(app.AuthenticateMiddleware).Post("/", app.createPostCommentHandler)
-					r.Get("/", app.getPostCommentsHandler)
+				r.Route("/{user_id}", func(r chi.Router) {
+					r.Use(app.userContextMiddleware)
+
+					r.Get("/", app.getUserHandler)
+
+					r.Group(func(r chi.Router) {
+						r.Use(app.OptionalAuthenticateMiddleware)
+
+						r.Get("/profile", app.getUserProfileHandler)
+						r.Get("/followers", app.getFollowersHandler)
+						r.Get("/following", app.getFollowingHandler)
+						r.Get("/posts", app.getUserPostsHandler)
+					})
+
+					r.Group(func(r chi.Router) {
+						r.Use(app.AuthenticateMiddleware)
+
+						r.Get("/is_followed", app.isFollowedHandler)
+						r.Put("/follow", app.followUserHandler)
+						r.Put("/unfollow", app.unfollowUserHandler)
+						r.Put("/block", app.blockUserHandler)
+						r.Delete("/block", app.unblockUserHandler)
+					})
 				})
 			})
-		})
-
-		r.Route("/users", func(r chi.Router) {
-			r.Get("/explore", app.getExploreHandler)
 
-			r.Group(func(r chi.Router) {
+			r.Route("/conversations", func(r chi.Router) {
 				r.Use(app.AuthenticateMiddleware)
 
-				r.Get("/me", app.getMeHandler)
-				r.Get("/feed", app.getUserFeedHandler)
+				r.Post("/", app.createConversationHandler)
+				r.Get("/", app.getConversationsHandler)
+
+				r.Route("/{conversation_id}", func(r chi.Router) {
+					r.Use(app.conversationContextMiddleware)
+
+					r.Get("/", app.getConversationHandler)
+					r.Get("/messages", app.getMessagesHandler)
+					r.Post("/messages", app.sendMessageHandler)
+					r.Put("/read", app.markConversationReadHandler)
+				})
 			})
 
-			r.Route("/{user_id}", func(r chi.Router) {
-				r.Use(app.userContextMiddleware)
+			r.With(app.AuthenticateMiddleware).Post("/reports", app.createReportHandler)
 
-				r.Get("/", app.getUserHandler)
-				r.Get("/profile", app.getUserProfileHandler)
+			r.Get("/exports/{export_id}/download", app.downloadExportHandler)
 
-				r.Group(func(r chi.Router) {
-					r.Use(app.AuthenticateMiddleware)
+			r.Route("/moderation", func(r chi.Router) {
+				r.Use(app.AuthenticateMiddleware)
+				r.Use(app.requireRoleMiddleware(store.RoleModerator, store.RoleAdmin))
 
-					r.Get("/posts", app.getUserPostsHandler)
-					r.Get("/is_followed", app.isFollowedHandler)
-					r.Put("/follow", app.followUserHandler)
-					r.Put("/unfollow", app.unfollowUserHandler)
+				r.Get("/reports", app.getReportsQueueHandler)
+				r.Put("/reports/{report_id}/claim", app.claimReportHandler)
+				r.Put("/reports/{report_id}/resolve", app.resolveReportHandler)
+				r.Get("/actions", app.getModerationActionsHandler)
+				r.Delete("/posts/{post_id}", app.deletePostAsStaffHandler)
+
+				r.Route("/users/{user_id}/suspension", func(r chi.Router) {
+					r.Use(app.userContextMiddleware)
+
+					r.Put("/", app.suspendUserHandler)
+					r.Delete("/", app.liftSuspensionHandler)
 				})
 			})
-		})
 
-		r.Route("/auth", func(r chi.Router) {
-			//TODO: handle duplicate email/username
-			r.Post("/register", app.registerUserHandler)
-			r.Post("/login", app.loginUserHandler)
-			r.Get("/verify/{token}", app.verifyUserHandler)
+			r.Route("/admin", func(r chi.Router) {
+				r.Use(app.AuthenticateMiddleware)
+				r.Use(app.requireRoleMiddleware(store.RoleAdmin))
+
+				r.Route("/screening/rules", func(r chi.Router) {
+					r.Get("/", app.getScreeningRulesHandler)
+					r.Post("/", app.createScreeningRuleHandler)
+					r.Delete("/{rule_id}", app.deleteScreeningRuleHandler)
+				})
+
+				r.With(app.userContextMiddleware).Put("/users/{user_id}/role", app.updateUserRoleHandler)
+
+				r.Get("/audit", app.getAuditLogHandler)
+			})
+
+			r.Route("/auth", func(r chi.Router) {
+				//TODO: handle duplicate email/username
+				r.Post("/register", app.registerUserHandler)
+				r.Post("/login", app.loginUserHandler)
+				r.Get("/verify/{token}", app.verifyUserHandler)
+			})
 		})
 	})
 	return r
@@ -135,6 +324,35 @@ func (app *application) run(mux http.Handler) error {
 		IdleTimeout:  time.Minute,
 	}
 
+	// websocket connections are hijacked and the streams never end on their
+	// own, the server doesn't close either itself
+	srv.RegisterOnShutdown(func() {
+		app.gateway.Shutdown()
+		app.hub.Close()
+	})
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		quit := make(chan os.Signal, 1)
+		signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+		s := <-quit
+
+		log.Info().Str("signal", s.String()).Msg("Shutting down server")
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		shutdownErr <- srv.Shutdown(ctx)
+	}()
+
 	log.Info().Str("addr", srv.Addr).Str("env", app.config.env).Msg("Starting server")
-	return srv.ListenAndServe()
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	if err := <-shutdownErr; err != nil {
+		return err
+	}
+
+	log.Info().Msg("Server stopped")
+	return nil
 }
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+	"github.com/shehab910/social/internal/store"
+)
+
+type auditEvent struct {
+	Action string
+	// ActorID is 0 for anonymous actors, like failed logins of unknown emails
+	ActorID    int64
+	TargetType string
+	TargetID   int64
+	// Before and After are snapshots of the target, marshaled to json
+	Before any
+	After  any
+}
+
+// audit appends the event to the audit log, a failure is logged and doesn't
+// fail the request that already happened
+func (app *application) audit(r *http.Request, event auditEvent) {
+	entry := &store.AuditEntry{Action: event.Action}
+
+	if event.ActorID != 0 {
+		entry.ActorID = &event.ActorID
+	}
+	if event.TargetType != "" {
+		entry.TargetType = &event.TargetType
+		entry.TargetID = &event.TargetID
+	}
+
+	// RealIP leaves the port when no proxy header is set
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	entry.IP = &ip
+
+	if requestId := middleware.GetReqID(r.Context()); requestId != "" {
+		entry.RequestID = &requestId
+	}
+
+	var err error
+	if event.Before != nil {
+		if entry.Before, err = json.Marshal(event.Before); err != nil {
+			log.Error().Err(err).Str("action", event.Action).Msg("failed to marshal audit snapshot")
+		}
+	}
+	if event.After != nil {
+		if entry.After, err = json.Marshal(event.After); err != nil {
+			log.Error().Err(err).Str("action", event.Action).Msg("failed to marshal audit snapshot")
+		}
+	}
+
+	// the entry is written even if the client went away
+	if err := app.store.Audit.Create(context.WithoutCancel(r.Context()), entry); err != nil {
+		log.Error().Err(err).Str("action", event.Action).Msg("failed to write audit entry")
+	}
+}
+
+func (app *application) getAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	cq := store.CursorPaginatedQuery{
+		Limit: 50,
+	}
+
+	if err := cq.Parse(r); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	var filter store.AuditFilter
+	if err := filter.Parse(r); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(filter); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	page, err := app.store.Audit.Query(r.Context(), filter, cq)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			app.badRequestError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// exportAuditLogHandler streams the matching entries as newline delimited json
+func (app *application) exportAuditLogHandler(w http.ResponseWriter, r *http.Request) {
+	var filter store.AuditFilter
+	if err := filter.Parse(r); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(filter); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// large exports outlast the server write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	started := false
+	enc := json.NewEncoder(w)
+	err := app.store.Audit.Export(r.Context(), filter, func(entry store.AuditEntry) error {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.Header().Set("Content-Disposition", `attachment; filename="audit.ndjson"`)
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		return enc.Encode(entry)
+	})
+	if err != nil {
+		// the status is already sent, the truncated body is all we can do
+		if started {
+			log.Error().Err(err).Msg("audit export interrupted")
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !started {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -36,6 +36,11 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if store.IsReservedUsername(payload.Username) {
+		app.unProcessableContent(w, r, ErrReservedUsername)
+		return
+	}
+
 	hashedPass, err := utils.HashPassword(payload.Password)
 	if err != nil {
 		app.internalServerError(w, r, err)
@@ -88,6 +93,7 @@ func (app *application) loginUserHandler(w http.ResponseWriter, r *http.Request)
 	dbUser, err := app.store.Users.GetByEmail(r.Context(), payload.Email)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
+			app.audit(r, auditEvent{Action: store.AuditLoginFailed, After: loginAttempt{Email: payload.Email, Reason: "unknown_email"}})
 			app.invalidCredentialsResponse(w, r)
 			return
 		}
@@ -96,10 +102,22 @@ func (app *application) loginUserHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	if !utils.CheckPasswordHash(payload.Password, dbUser.Password) {
+		app.auditLoginFailed(r, dbUser, "wrong_password")
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
 
+	suspension, err := app.store.Suspensions.GetActive(r.Context(), dbUser.ID)
+	if err == nil {
+		app.auditLoginFailed(r, dbUser, "suspended")
+		app.suspendedResponse(w, r, suspension)
+		return
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
 	token, err := utils.GenerateToken(
 		dbUser.Username,
 		dbUser.ImgUrl,
@@ -139,17 +157,53 @@ func (app *application) loginUserHandler(w http.ResponseWriter, r *http.Request)
 				return
 			}
 		}
+		app.auditLoginFailed(r, dbUser, "unverified")
 		app.customErrorResponse(w, r, http.StatusForbidden, errors.New("user not verified, verification email sent"))
 		return
 	}
 
+	// logging in during the grace period keeps the account
+	canceled, err := app.store.AccountDeletions.Cancel(r.Context(), dbUser.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if canceled {
+		app.audit(r, auditEvent{
+			Action:     store.AuditDeletionCancel,
+			ActorID:    dbUser.ID,
+			TargetType: store.AuditTargetUser,
+			TargetID:   dbUser.ID,
+		})
+	}
+
 	app.store.Users.UpdateLastLogin(r.Context(), dbUser.ID)
+	app.audit(r, auditEvent{
+		Action:     store.AuditLogin,
+		ActorID:    dbUser.ID,
+		TargetType: store.AuditTargetUser,
+		TargetID:   dbUser.ID,
+	})
 	app.jsonResponse(w, http.StatusOK, map[string]string{
 		"message": "Login successful",
 		"token":   token,
 	})
 }
 
+type loginAttempt struct {
+	Email  string `json:"email"`
+	Reason string `json:"reason"`
+}
+
+func (app *application) auditLoginFailed(r *http.Request, user *store.User, reason string) {
+	app.audit(r, auditEvent{
+		Action:     store.AuditLoginFailed,
+		TargetType: store.AuditTargetUser,
+		TargetID:   user.ID,
+		After:      loginAttempt{Email: user.Email, Reason: reason},
+	})
+}
+
 func (app *application) verifyUserHandler(w http.ResponseWriter, r *http.Request) {
 	token := chi.URLParam(r, "token")
 	claims, err := utils.ValidateToken(token, app.config.jwtSecret)
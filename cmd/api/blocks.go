@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/shehab910/social/internal/store"
+)
+
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	blockedUser := getUserFromCtx(r)
+	blocker := app.getCurrentUserFromCtx(r)
+
+	if blockedUser.ID == blocker.UserId {
+		app.customErrorResponse(w, r, http.StatusBadRequest, ErrSelfBlock)
+		return
+	}
+
+	if err := app.store.Blocks.Block(r.Context(), blocker.UserId, blockedUser.ID); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			app.conflictResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	blockedUser := getUserFromCtx(r)
+	blocker := app.getCurrentUserFromCtx(r)
+
+	if err := app.store.Blocks.Unblock(r.Context(), blocker.UserId, blockedUser.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) getBlockedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUserFromCtx(r)
+
+	users, err := app.store.Blocks.GetBlockedUsers(r.Context(), user.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
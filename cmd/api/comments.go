@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
+	"github.com/shehab910/social/internal/realtime"
+	"github.com/shehab910/social/internal/screening"
 	"github.com/shehab910/social/internal/store"
 )
 
 type CreateCommentPayload struct {
 	Content string `json:"content" validate:"required,max=1000"`
+	// ParentCommentID makes the comment a reply to another comment of the post
+	ParentCommentID *int64 `json:"parent_comment_id" validate:"omitempty,gt=0"`
 }
 
 func (app *application) createPostCommentHandler(w http.ResponseWriter, r *http.Request) {
@@ -25,17 +31,76 @@ func (app *application) createPostCommentHandler(w http.ResponseWriter, r *http.
 	post := getPostFromCtx(r)
 	user := app.getCurrentUserFromCtx(r)
 
+	isBlocked, err := app.store.Blocks.IsBlockedEither(r.Context(), post.UserID, user.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if isBlocked {
+		app.customErrorResponse(w, r, http.StatusForbidden, ErrBlockedUser)
+		return
+	}
+
+	var parentAuthorId int64
+	if payload.ParentCommentID != nil {
+		parentAuthorId, err = app.store.Comments.GetAuthorId(r.Context(), post.ID, *payload.ParentCommentID)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				app.notFoundResponse(w, r, err)
+				return
+			}
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	decision, ok := app.screenContent(w, r, screening.Content{
+		Kind:     screening.KindComment,
+		AuthorID: user.UserId,
+		Text:     payload.Content,
+	})
+	if !ok {
+		return
+	}
+
+	commentEntities, err := app.parseEntities(r.Context(), payload.Content)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
 	comment := &store.Comment{
-		Content: payload.Content,
-		PostID:  post.ID,
-		UserID:  user.UserId,
+		Content:         payload.Content,
+		Entities:        commentEntities,
+		PostID:          post.ID,
+		UserID:          user.UserId,
+		ParentCommentID: payload.ParentCommentID,
+		User:            store.User{ID: user.UserId, Username: user.Username},
 	}
 
-	if err := app.store.Comments.Create(r.Context(), comment); err != nil {
+	// the comment and its mentions are saved together, the notifications and
+	// events only go out once both are committed
+	var mentioned []store.User
+	err = app.store.WithTx(r.Context(), func(tx *store.Storage) error {
+		if err := tx.Comments.Create(r.Context(), comment); err != nil {
+			return err
+		}
+
+		var err error
+		mentioned, err = tx.Mentions.CreateForComment(r.Context(), comment)
+		return err
+	})
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	app.flagForReview(r.Context(), decision, store.ReportTargetComment, comment.ID)
+	app.notifyMentions(r.Context(), user.UserId, mentioned, "comment", comment.Content, post.ID)
+
+	app.notifyCommentActivity(r.Context(), post, user.UserId, parentAuthorId)
+	app.publishFrom(r.Context(), realtime.PostTopic(post.ID), realtime.EventComment, user.UserId, comment)
+
 	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -43,10 +108,24 @@ func (app *application) createPostCommentHandler(w http.ResponseWriter, r *http.
 
 }
 
+// notifyCommentActivity notifies the post author of a new comment, and the
+// author of the comment replied to (0 for top level comments) of the reply
+func (app *application) notifyCommentActivity(ctx context.Context, post *store.Post, commenterId int64, parentAuthorId int64) {
+	if parentAuthorId != 0 {
+		app.notify(ctx, []int64{parentAuthorId}, commenterId, store.NotificationReply, &post.ID)
+	}
+
+	// a reply to the post author's own comment is only notified as a reply
+	if parentAuthorId != post.UserID {
+		app.notify(ctx, []int64{post.UserID}, commenterId, store.NotificationComment, &post.ID)
+	}
+}
+
 func (app *application) getPostCommentsHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
+	viewer := app.getCurrentUserFromCtx(r)
 
-	comments, err := app.store.Comments.GetByPostIdWithUser(r.Context(), post.ID)
+	comments, err := app.store.Comments.GetByPostIdWithUser(r.Context(), post.ID, viewer.UserId)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shehab910/social/internal/realtime"
+	"github.com/shehab910/social/internal/store"
+	"github.com/shehab910/social/internal/utils"
+)
+
+type accountDeletionConfig struct {
+	grace time.Duration
+	// content is store.DeletionContentDelete or store.DeletionContentAnonymize
+	content       string
+	purgeInterval time.Duration
+	batchSize     int
+}
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type deletionSnapshot struct {
+	RequestedAt time.Time `json:"requested_at"`
+	PurgeAt     time.Time `json:"purge_at"`
+}
+
+// deleteAccountHandler schedules the deletion of the current user's account,
+// logging in before the grace period is over cancels it
+func (app *application) deleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	var payload DeleteAccountPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.unProcessableContent(w, r, err)
+		return
+	}
+
+	claims := app.getCurrentUserFromCtx(r)
+
+	user, err := app.store.Users.GetById(r.Context(), claims.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if !utils.CheckPasswordHash(payload.Password, user.Password) {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	requestedAt, err := app.store.AccountDeletions.Request(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	snapshot := deletionSnapshot{
+		RequestedAt: requestedAt,
+		PurgeAt:     requestedAt.Add(app.config.deletion.grace),
+	}
+
+	app.audit(r, auditEvent{
+		Action:     store.AuditDeletionRequest,
+		ActorID:    user.ID,
+		TargetType: store.AuditTargetUser,
+		TargetID:   user.ID,
+		After:      snapshot,
+	})
+
+	app.endUserSessions(r, user.ID, realtime.EventDeletionRequested)
+
+	app.jsonResponse(w, http.StatusAccepted, snapshot)
+}
+
+// purgeDeletedAccounts hard deletes the accounts whose grace period is over,
+// one transaction each so a failing account doesn't hold back the others
+func (app *application) purgeDeletedAccounts(ctx context.Context) error {
+	cfg := app.config.deletion
+
+	ids, err := app.store.AccountDeletions.GetDue(ctx, cfg.grace, cfg.batchSize)
+	if err != nil {
+		return err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		paths, err := app.store.AccountDeletions.Purge(ctx, id, cfg.grace, cfg.content)
+		if err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				log.Error().Err(err).Int64("userId", id).Msg("failed to purge account")
+			}
+			continue
+		}
+		purged++
+
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Error().Err(err).Str("path", path).Msg("failed to remove export of purged account")
+			}
+		}
+
+		targetType := store.AuditTargetUser
+		entry := &store.AuditEntry{
+			Action:     store.AuditAccountPurge,
+			TargetType: &targetType,
+			TargetID:   &id,
+		}
+		if err := app.store.Audit.Create(ctx, entry); err != nil {
+			log.Error().Err(err).Str("action", entry.Action).Msg("failed to write audit entry")
+		}
+	}
+
+	if purged > 0 {
+		log.Info().Int("count", purged).Str("content", cfg.content).Msg("purged deleted accounts")
+	}
+
+	return nil
+}
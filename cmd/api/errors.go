@@ -5,16 +5,32 @@ import (
 	"net/http"
 
 	"github.com/rs/zerolog/log"
+	"github.com/shehab910/social/internal/store"
 )
 
 var (
-	ErrEmptyJSONBody   = errors.New("empty json body")
-	ErrWrongFormat     = errors.New("wrong format")
-	ErrAlreadyExists   = errors.New("resource already exists")
-	ErrGenericInternal = errors.New("something went wrong")
-	ErrNotFound        = errors.New("resource not found")
-	ErrInvalidCreds    = errors.New("invalid credentials")
-	ErrUnauthorized    = errors.New("unauthorized")
+	ErrEmptyJSONBody    = errors.New("empty json body")
+	ErrWrongFormat      = errors.New("wrong format")
+	ErrAlreadyExists    = errors.New("resource already exists")
+	ErrGenericInternal  = errors.New("something went wrong")
+	ErrNotFound         = errors.New("resource not found")
+	ErrInvalidCreds     = errors.New("invalid credentials")
+	ErrUnauthorized     = errors.New("unauthorized")
+	ErrSelfFollow       = errors.New("you can't follow yourself")
+	ErrSelfBlock        = errors.New("you can't block yourself")
+	ErrBlockedUser      = errors.New("you can't interact with this user")
+	ErrPrivateAccount   = errors.New("this account is private")
+	ErrPostNotVisible   = errors.New("post is not visible to the viewer")
+	ErrPublishAtInPast  = errors.New("publish_at must be in the future")
+	ErrDMNotAllowed     = errors.New("this user only accepts messages from mutual follows")
+	ErrSelfConversation = errors.New("a conversation needs at least another member")
+	ErrForbidden        = errors.New("you don't have permission to do this")
+	ErrSelfReport       = errors.New("you can't report yourself")
+	ErrAccountSuspended = errors.New("your account is suspended")
+	ErrAccountBanned    = errors.New("your account is permanently banned")
+	ErrContentRejected  = errors.New("content rejected")
+	ErrPendingDeletion  = errors.New("your account is scheduled for deletion, log in again to cancel it")
+	ErrReservedUsername = errors.New("this username is reserved")
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
@@ -66,6 +82,22 @@ func (app *application) customErrorResponse(w http.ResponseWriter, r *http.Reque
 	writeJSONErr(w, status, err.Error())
 }
 
+func (app *application) suspendedResponse(w http.ResponseWriter, r *http.Request, suspension *store.Suspension) {
+	log.Warn().Int64("userId", suspension.UserID).Str("path", r.URL.Path).Str("method", r.Method).Msg("suspended user request")
+
+	type envelope struct {
+		Error string `json:"error"`
+		*store.Suspension
+	}
+
+	message := ErrAccountSuspended.Error()
+	if suspension.Permanent {
+		message = ErrAccountBanned.Error()
+	}
+
+	writeJSON(w, http.StatusForbidden, &envelope{Error: message, Suspension: suspension})
+}
+
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter string) {
 	log.Warn().Str("method", r.Method).Str("path", r.URL.Path).Msg("rate limit exceeded")
 
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/shehab910/social/internal/export"
+	"github.com/shehab910/social/internal/mailer"
+	"github.com/shehab910/social/internal/store"
+)
+
+var ErrExportInProgress = errors.New("an export of your data is already in progress")
+
+type exportConfig struct {
+	// dir must be shared by the replicas serving the downloads
+	dir             string
+	linkTTL         time.Duration
+	timeout         time.Duration
+	cleanupInterval time.Duration
+}
+
+func (app *application) requestExportHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUserFromCtx(r)
+
+	dataExport, err := app.store.Exports.Create(r.Context(), user.UserId, app.config.export.timeout)
+	if err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			app.customErrorResponse(w, r, http.StatusConflict, ErrExportInProgress)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	go app.buildExport(dataExport)
+
+	if err := app.jsonResponse(w, http.StatusAccepted, dataExport); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// buildExport writes the archive of the user and emails them a signed link to it
+func (app *application) buildExport(dataExport *store.DataExport) {
+	ctx, cancel := context.WithTimeout(context.Background(), app.config.export.timeout)
+	defer cancel()
+
+	// the status is recorded even when the build ran out of time, otherwise
+	// the export would stay pending for good
+	bookkeepingCtx := context.WithoutCancel(ctx)
+
+	logger := log.With().Int64("exportId", dataExport.ID).Int64("userId", dataExport.UserID).Logger()
+
+	fail := func(err error) {
+		logger.Error().Err(err).Msg("data export failed")
+		if err := app.store.Exports.MarkFailed(bookkeepingCtx, dataExport.ID, "the export couldn't be built"); err != nil {
+			logger.Error().Err(err).Msg("failed to mark data export as failed")
+		}
+	}
+
+	archive, err := app.store.Exports.Collect(ctx, dataExport.UserID)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	if err := os.MkdirAll(app.config.export.dir, 0o700); err != nil {
+		fail(err)
+		return
+	}
+
+	// written aside and renamed so a download never sees a partial archive
+	path := filepath.Join(app.config.export.dir, "export-"+strconv.FormatInt(dataExport.ID, 10)+".zip")
+	tmp, err := os.CreateTemp(app.config.export.dir, "export-*.zip.tmp")
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := export.WriteArchive(tmp, archive); err != nil {
+		tmp.Close()
+		fail(err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		fail(err)
+		return
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		fail(err)
+		return
+	}
+
+	expiresAt := time.Now().Add(app.config.export.linkTTL).Truncate(time.Second)
+	if err := app.store.Exports.MarkReady(bookkeepingCtx, dataExport, path, expiresAt); err != nil {
+		os.Remove(path)
+		fail(err)
+		return
+	}
+
+	link := app.config.serverUrl + "/v1/exports/" + strconv.FormatInt(dataExport.ID, 10) + "/download" +
+		"?expires=" + strconv.FormatInt(expiresAt.Unix(), 10) +
+		"&signature=" + export.Sign(app.config.jwtSecret, dataExport.ID, expiresAt)
+
+	err = app.mailer.SendDataExportEmail(mailer.DataExportEmailTemplateData{
+		Username:     archive.Profile.Username,
+		Email:        archive.Profile.Email,
+		DownloadLink: link,
+		ExpiresAt:    expiresAt.UTC().Format("January 2, 2006 15:04 MST"),
+		SupportEmail: app.config.email.SupportEmail,
+	})
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to send data export email")
+		return
+	}
+
+	logger.Info().Msg("data export ready")
+}
+
+// downloadExportHandler is authenticated by the link signature, the link is
+// opened from the email where the client has no token
+func (app *application) downloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	exportId, err := strconv.ParseInt(chi.URLParam(r, "export_id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, ErrWrongFormat)
+		return
+	}
+
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, ErrWrongFormat)
+		return
+	}
+
+	if !export.Verify(app.config.jwtSecret, exportId, time.Unix(expires, 0), r.URL.Query().Get("signature")) {
+		app.customErrorResponse(w, r, http.StatusForbidden, errors.New("invalid or expired download link"))
+		return
+	}
+
+	dataExport, err := app.store.Exports.GetById(r.Context(), exportId)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if dataExport.Status != store.ExportStatusReady || dataExport.FilePath == nil {
+		app.notFoundResponse(w, r, errors.New("export is not ready"))
+		return
+	}
+
+	file, err := os.Open(*dataExport.FilePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	rc := http.NewResponseController(w)
+	// big archives outlast the server write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="social-data.zip"`)
+	http.ServeContent(w, r, "social-data.zip", *dataExport.CompletedAt, file)
+}
+
+func (app *application) purgeExpiredExports(ctx context.Context) error {
+	paths, err := app.store.Exports.ExpireReady(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Error().Err(err).Str("path", path).Msg("failed to remove expired export")
+		}
+	}
+
+	if len(paths) > 0 {
+		log.Info().Int("count", len(paths)).Msg("purged expired exports")
+	}
+
+	return nil
+}
@@ -8,39 +8,41 @@ import (
 )
 
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
-	pfq := store.PaginatedFeedQuery{
-		Limit:  20,
-		Offset: 0,
-		Sort:   "desc",
-		Tags:   []string{},
+	fq := store.CursorFeedQuery{
+		Limit: 20,
+		Tags:  []string{},
 	}
 
-	if err := pfq.Parse(r); err != nil {
+	if err := fq.Parse(r); err != nil {
 		app.badRequestError(w, r, err)
 		return
 	}
 
-	if err := Validate.Struct(pfq); err != nil {
+	if err := Validate.Struct(fq); err != nil {
 		app.badRequestError(w, r, err)
 		return
 	}
 
-	user := app.getCurrentUserFromCtx(r)
-	posts, err := app.store.Posts.GetUserFeed(r.Context(), user.UserId, pfq)
-	if err != nil {
-		app.internalServerError(w, r, err)
+	opts := app.config.feed
+	if err := opts.Parse(r); err != nil {
+		app.badRequestError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
-		if errors.Is(err, store.ErrNotFound) {
-			app.notFoundResponse(w, r, err)
+	user := app.getCurrentUserFromCtx(r)
+	page, err := app.store.Posts.GetUserFeed(r.Context(), user.UserId, fq, opts)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			app.badRequestError(w, r, err)
 			return
 		}
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
 }
 
 func (app *application) getExploreHandler(w http.ResponseWriter, r *http.Request) {
@@ -61,7 +63,10 @@ func (app *application) getExploreHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	posts, err := app.store.Posts.GetExploreFeed(r.Context(), pfq)
+	viewer := app.getCurrentUserFromCtx(r)
+	posts, err := app.store.Posts.GetExploreFeed(r.Context(), pfq, viewer.UserId, store.FeedOptions{
+		HideSuspendedAuthors: app.config.feed.HideSuspendedAuthors,
+	})
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
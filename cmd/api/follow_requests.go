@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shehab910/social/internal/store"
+	"github.com/shehab910/social/internal/timeline"
+)
+
+// requestFollow creates a pending follow request for a private account
+func (app *application) requestFollow(w http.ResponseWriter, r *http.Request, requesterId int64, userId int64) {
+	isFollowed, err := app.store.Followers.IsFollowed(r.Context(), requesterId, userId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if isFollowed {
+		app.conflictResponse(w, r, store.ErrConflict)
+		return
+	}
+
+	if err := app.store.FollowRequests.Create(r.Context(), requesterId, userId); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			app.conflictResponse(w, r, err)
+			return
+		}
+		if errors.Is(err, store.ErrBlocked) {
+			app.customErrorResponse(w, r, http.StatusForbidden, ErrBlockedUser)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, map[string]string{"status": "requested"}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) getFollowRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUserFromCtx(r)
+
+	requests, err := app.store.FollowRequests.GetPendingByUserId(r.Context(), user.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, requests); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) acceptFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	requesterId, err := strconv.ParseInt(chi.URLParam(r, "requester_id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, ErrWrongFormat)
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+
+	if err := app.store.FollowRequests.Accept(r.Context(), requesterId, user.UserId); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.fanOut.Enqueue(timeline.Job{Kind: timeline.JobBackfill, FollowerID: requesterId, FollowedID: user.UserId})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) declineFollowRequestHandler(w http.ResponseWriter, r *http.Request) {
+	requesterId, err := strconv.ParseInt(chi.URLParam(r, "requester_id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, ErrWrongFormat)
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+
+	if err := app.store.FollowRequests.Delete(r.Context(), requesterId, user.UserId); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
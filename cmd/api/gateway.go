@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shehab910/social/internal/realtime"
+	"github.com/shehab910/social/internal/store"
+	"github.com/shehab910/social/internal/utils"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	gatewaySubscribe   = "subscribe"
+	gatewayUnsubscribe = "unsubscribe"
+	gatewayTyping      = "typing"
+	gatewaySubscribed  = "subscribed"
+	gatewayHeartbeat   = "heartbeat"
+	gatewayShutdown    = "shutdown"
+	gatewayError       = "error"
+)
+
+var (
+	errGatewayRateLimited   = errors.New("rate limit exceeded")
+	errGatewayUnknownType   = errors.New("unknown message type")
+	errGatewayNotSubscribed = errors.New("not subscribed to this post")
+	errGatewayTooManyRooms  = errors.New("too many subscribed posts")
+)
+
+type gatewayConfig struct {
+	messagesPerSecond int
+	messageBurst      int
+	maxMessageSize    int
+	maxRooms          int
+	writeTimeout      time.Duration
+}
+
+// gatewayMessage is used both ways, clients send subscribe, unsubscribe and
+// typing messages for a post and receive the post events
+type gatewayMessage struct {
+	Type   string          `json:"type"`
+	PostID int64           `json:"post_id,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type typingEvent struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// gateway keeps track of the open connections to close them on shutdown
+type gateway struct {
+	mu       sync.Mutex
+	conns    map[*websocket.Conn]bool
+	shutdown bool
+}
+
+func newGateway() *gateway {
+	return &gateway{conns: map[*websocket.Conn]bool{}}
+}
+
+// add returns false once the gateway is shutting down
+func (g *gateway) add(conn *websocket.Conn) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.shutdown {
+		return false
+	}
+	g.conns[conn] = true
+	return true
+}
+
+func (g *gateway) remove(conn *websocket.Conn) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.conns, conn)
+}
+
+// Shutdown tells the clients to reconnect later and closes their connections,
+// it's registered with http.Server.RegisterOnShutdown since hijacked
+// connections aren't tracked by the server
+func (g *gateway) Shutdown() {
+	g.mu.Lock()
+	g.shutdown = true
+	conns := make([]*websocket.Conn, 0, len(g.conns))
+	for conn := range g.conns {
+		conns = append(conns, conn)
+	}
+	g.mu.Unlock()
+
+	// sent outside the lock and in parallel, a slow client delays neither
+	// the others nor the connection handlers removing themselves
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn.SetWriteDeadline(time.Now().Add(time.Second))
+			websocket.JSON.Send(conn, gatewayMessage{Type: gatewayShutdown})
+			conn.Close()
+		}()
+	}
+	wg.Wait()
+}
+
+// tokenBucket limits the messages a single connection can send
+type tokenBucket struct {
+	tokens float64
+	burst  float64
+	rate   float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{tokens: float64(burst), burst: float64(burst), rate: rate, last: time.Now()}
+}
+
+func (b *tokenBucket) allow() bool {
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (app *application) gatewayHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUserFromCtx(r)
+
+	server := websocket.Server{
+		// the gateway is token authenticated, any origin is accepted like CORS does
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			app.serveGatewayConn(conn, user)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+func (app *application) serveGatewayConn(conn *websocket.Conn, user utils.TokenClaims) {
+	defer conn.Close()
+
+	if !app.gateway.add(conn) {
+		return
+	}
+	defer app.gateway.remove(conn)
+
+	conn.MaxPayloadBytes = app.config.gateway.maxMessageSize
+	// the server read timeout still applies to the hijacked connection
+	conn.SetReadDeadline(time.Time{})
+
+	// the user topic is only joined to learn about suspensions
+	sub, _ := app.hub.Subscribe([]string{realtime.UserTopic(user.UserId)}, 0)
+	defer app.hub.Unsubscribe(sub)
+
+	replies := make(chan gatewayMessage, 16)
+	done := make(chan struct{})
+	defer close(done)
+
+	go app.writeGatewayConn(conn, user, sub, replies, done)
+
+	reply := func(msg gatewayMessage) {
+		select {
+		case replies <- msg:
+		default:
+			// the writer is stuck, the hub drops the subscriber soon
+		}
+	}
+
+	limiter := newTokenBucket(float64(app.config.gateway.messagesPerSecond), app.config.gateway.messageBurst)
+	rooms := map[int64]bool{}
+
+	for {
+		var msg gatewayMessage
+		if err := websocket.JSON.Receive(conn, &msg); err != nil {
+			return
+		}
+
+		if !limiter.allow() {
+			reply(gatewayMessage{Type: gatewayError, PostID: msg.PostID, Error: errGatewayRateLimited.Error()})
+			continue
+		}
+
+		if err := app.handleGatewayMessage(conn, user, sub, rooms, msg); err != nil {
+			reply(gatewayMessage{Type: gatewayError, PostID: msg.PostID, Error: err.Error()})
+			continue
+		}
+
+		if msg.Type == gatewaySubscribe {
+			reply(gatewayMessage{Type: gatewaySubscribed, PostID: msg.PostID})
+		}
+	}
+}
+
+func (app *application) handleGatewayMessage(conn *websocket.Conn, user utils.TokenClaims, sub *realtime.Subscriber, rooms map[int64]bool, msg gatewayMessage) error {
+	ctx := conn.Request().Context()
+	topic := realtime.PostTopic(msg.PostID)
+
+	switch msg.Type {
+	case gatewaySubscribe:
+		if !rooms[msg.PostID] && len(rooms) >= app.config.gateway.maxRooms {
+			return errGatewayTooManyRooms
+		}
+
+		post, err := app.store.Posts.GetByIdWithUser(ctx, msg.PostID)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+			log.Error().Err(err).Int64("postId", msg.PostID).Msg("failed to load gateway post")
+			return errors.New("the server encountered a problem")
+		}
+
+		canView, err := app.canViewPost(ctx, user.UserId, post)
+		if err != nil {
+			log.Error().Err(err).Int64("postId", msg.PostID).Msg("failed to check gateway post visibility")
+			return errors.New("the server encountered a problem")
+		}
+		if !canView {
+			return ErrPostNotVisible
+		}
+
+		rooms[msg.PostID] = true
+		app.hub.Join(sub, topic)
+	case gatewayUnsubscribe:
+		delete(rooms, msg.PostID)
+		app.hub.Leave(sub, topic)
+	case gatewayTyping:
+		if !rooms[msg.PostID] {
+			return errGatewayNotSubscribed
+		}
+		if err := app.hub.PublishEphemeral(ctx, topic, realtime.EventTyping, user.UserId, typingEvent{UserID: user.UserId, Username: user.Username}); err != nil {
+			log.Error().Err(err).Str("topic", topic).Msg("failed to publish typing event")
+		}
+	default:
+		return errGatewayUnknownType
+	}
+
+	return nil
+}
+
+// writeGatewayConn is the only writer of conn, a subscriber falling behind is
+// dropped by the hub and its connection closed so the client reconnects
+func (app *application) writeGatewayConn(conn *websocket.Conn, user utils.TokenClaims, sub *realtime.Subscriber, replies <-chan gatewayMessage, done <-chan struct{}) {
+	heartbeat := time.NewTicker(app.config.stream.heartbeat)
+	defer heartbeat.Stop()
+
+	filter := app.newBlockFilter(user.UserId)
+
+	send := func(msg gatewayMessage) bool {
+		conn.SetWriteDeadline(time.Now().Add(app.config.gateway.writeTimeout))
+		if err := websocket.JSON.Send(conn, msg); err != nil {
+			// unblocks the reader
+			conn.Close()
+			return false
+		}
+		return true
+	}
+
+	for {
+		var msg gatewayMessage
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				conn.Close()
+				return
+			}
+			if realtime.EndsSession(event.Type) {
+				send(gatewayMessage{Type: event.Type, Data: event.Data})
+				conn.Close()
+				return
+			}
+			if event.Type == realtime.EventTyping && isOwnTypingEvent(event, user.UserId) {
+				continue
+			}
+			if filter.hides(conn.Request().Context(), event) {
+				continue
+			}
+			postId, isPostEvent := realtime.PostIdFromTopic(event.Topic)
+			if !isPostEvent {
+				continue
+			}
+			msg = gatewayMessage{Type: event.Type, PostID: postId, Data: event.Data}
+		case msg = <-replies:
+		case <-heartbeat.C:
+			msg = gatewayMessage{Type: gatewayHeartbeat}
+		case <-done:
+			return
+		}
+
+		if !send(msg) {
+			return
+		}
+	}
+}
+
+func isOwnTypingEvent(event realtime.Event, userId int64) bool {
+	var typing typingEvent
+	return json.Unmarshal(event.Data, &typing) == nil && typing.UserID == userId
+}
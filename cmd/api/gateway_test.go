@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shehab910/social/internal/realtime"
+	"github.com/shehab910/social/internal/store"
+	"github.com/shehab910/social/internal/utils"
+	"golang.org/x/net/websocket"
+)
+
+// fakeBlocks blocks every pair made of the viewer and one of blocked
+type fakeBlocks struct {
+	viewerId int64
+	blocked  map[int64]bool
+}
+
+func (b fakeBlocks) Block(ctx context.Context, blockerId int64, blockedId int64) error {
+	return nil
+}
+
+func (b fakeBlocks) Unblock(ctx context.Context, blockerId int64, blockedId int64) error {
+	return nil
+}
+
+func (b fakeBlocks) GetBlockedUsers(ctx context.Context, userId int64) ([]store.User, error) {
+	return nil, nil
+}
+
+func (b fakeBlocks) IsBlockedEither(ctx context.Context, userId int64, otherUserId int64) (bool, error) {
+	switch {
+	case userId == b.viewerId:
+		return b.blocked[otherUserId], nil
+	case otherUserId == b.viewerId:
+		return b.blocked[userId], nil
+	}
+	return false, nil
+}
+
+func TestWriteGatewayConnSkipsBlockedUsers(t *testing.T) {
+	const (
+		postId    = 1
+		viewerId  = 10
+		blockedId = 20
+		friendId  = 30
+	)
+
+	blocks := fakeBlocks{viewerId: viewerId, blocked: map[int64]bool{blockedId: true}}
+	app := &application{
+		config: config{
+			stream:  streamConfig{heartbeat: time.Hour},
+			gateway: gatewayConfig{writeTimeout: time.Second},
+		},
+		store: &store.Storage{Blocks: blocks},
+		hub:   realtime.NewHub(realtime.NewMemoryBroker(16), realtime.Config{BufferSize: 16}),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.hub.Run(ctx)
+
+	sub, _ := app.hub.Subscribe([]string{realtime.PostTopic(postId)}, 0)
+	defer app.hub.Unsubscribe(sub)
+
+	done := make(chan struct{})
+	srv := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		app.writeGatewayConn(conn, utils.TokenClaims{UserId: viewerId}, sub, nil, done)
+	}))
+	defer srv.Close()
+	defer close(done)
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), "", srv.URL)
+	if err != nil {
+		t.Fatalf("dialing the gateway: %v", err)
+	}
+	defer conn.Close()
+
+	topic := realtime.PostTopic(postId)
+	publish := []func() error{
+		func() error {
+			return app.hub.PublishEphemeral(ctx, topic, realtime.EventTyping, blockedId, typingEvent{UserID: blockedId})
+		},
+		func() error {
+			return app.hub.PublishFrom(ctx, topic, realtime.EventComment, blockedId, store.Comment{UserID: blockedId})
+		},
+		func() error {
+			return app.hub.PublishFrom(ctx, topic, realtime.EventComment, friendId, store.Comment{UserID: friendId})
+		},
+	}
+	for _, fn := range publish {
+		if err := fn(); err != nil {
+			t.Fatalf("publishing: %v", err)
+		}
+	}
+
+	// events are delivered in order, the blocked user's ones would come first
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var msg gatewayMessage
+	if err := websocket.JSON.Receive(conn, &msg); err != nil {
+		t.Fatalf("receiving: %v", err)
+	}
+
+	if msg.Type != realtime.EventComment || msg.PostID != postId {
+		t.Fatalf("got %s event on post %d, want the comment on post %d", msg.Type, msg.PostID, postId)
+	}
+	if !strings.Contains(string(msg.Data), `"user_id":30`) {
+		t.Errorf("got the event %s, want the friend's comment", msg.Data)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shehab910/social/internal/store"
+)
+
+// startBackgroundJobs runs the periodic jobs until ctx is cancelled or the
+// returned stop is called, stop waits for the running jobs to return
+func (app *application) startBackgroundJobs(ctx context.Context) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+
+	runPeriodically(ctx, &wg, "refresh follow suggestions", app.config.suggestions.refreshInterval, func(ctx context.Context) error {
+		return app.store.Suggestions.RefreshActive(ctx, app.config.suggestions.limit)
+	})
+
+	runPeriodically(ctx, &wg, "publish scheduled posts", app.config.scheduler.interval, app.publishDuePosts)
+
+	runPeriodically(ctx, &wg, "purge trashed posts", app.config.trash.purgeInterval, func(ctx context.Context) error {
+		purged, err := app.store.Posts.PurgeDeleted(ctx, app.config.trash.retention)
+		if err != nil {
+			return err
+		}
+		if purged > 0 {
+			log.Info().Int64("count", purged).Msg("purged trashed posts")
+		}
+		return nil
+	})
+
+	runPeriodically(ctx, &wg, "purge expired exports", app.config.export.cleanupInterval, app.purgeExpiredExports)
+
+	runPeriodically(ctx, &wg, "purge deleted accounts", app.config.deletion.purgeInterval, app.purgeDeletedAccounts)
+
+	runPeriodically(ctx, &wg, "purge expired stream tickets", app.config.stream.ticketPurgeInterval, func(ctx context.Context) error {
+		_, err := app.store.StreamTickets.PurgeExpired(ctx)
+		return err
+	})
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func (app *application) publishDuePosts(ctx context.Context) error {
+	var (
+		posts     []store.Post
+		mentioned [][]store.User
+	)
+	err := app.store.WithTx(ctx, func(tx *store.Storage) error {
+		var err error
+		posts, err = tx.Posts.PublishDue(ctx, app.config.scheduler.batchSize)
+		if err != nil {
+			return err
+		}
+
+		// reset on every attempt, a retried transaction starts over
+		mentioned = make([][]store.User, len(posts))
+		for i := range posts {
+			mentioned[i], err = tx.Mentions.SyncPost(ctx, &posts[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		app.onPostPublished(ctx, &posts[i], mentioned[i])
+	}
+
+	return nil
+}
+
+// runPeriodically calls job every interval until ctx is cancelled, wg is done
+// once the running call returned
+func runPeriodically(ctx context.Context, wg *sync.WaitGroup, name string, interval time.Duration, job func(ctx context.Context) error) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				start := time.Now()
+				if err := job(ctx); err != nil {
+					log.Error().Err(err).Str("job", name).Msg("background job failed")
+					continue
+				}
+				log.Debug().Str("job", name).Dur("took", time.Since(start)).Msg("background job done")
+			}
+		}
+	}()
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -11,7 +14,10 @@ import (
 	"github.com/shehab910/social/internal/env"
 	"github.com/shehab910/social/internal/mailer"
 	ratelimiter "github.com/shehab910/social/internal/rate-limiter"
+	"github.com/shehab910/social/internal/realtime"
+	"github.com/shehab910/social/internal/screening"
 	"github.com/shehab910/social/internal/store"
+	"github.com/shehab910/social/internal/timeline"
 )
 
 const version = "v0.0.1"
@@ -37,7 +43,17 @@ func main() {
 		maxIdleConns: env.GetInt("DB_MAX_IDLE_CONNS", 30),
 		maxIdleTime:  env.GetString("DB_MAX_IDLE_TIME", "15m"),
 		schemaName:   env.GetString("DB_SCHEMA_NAME", "social"),
+		tx: store.TxConfig{
+			MaxRetries: env.GetInt("DB_TX_MAX_RETRIES", store.DefaultTxConfig.MaxRetries),
+			RetryDelay: env.GetDuration("DB_TX_RETRY_DELAY", store.DefaultTxConfig.RetryDelay),
+		},
+	}
+
+	isolation, err := store.ParseIsolationLevel(env.GetString("DB_TX_ISOLATION", ""))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid DB_TX_ISOLATION")
 	}
+	dbCfg.tx.Isolation = isolation
 
 	getAddr := func() string {
 		// get port from PORT first and fall back to addr
@@ -65,6 +81,78 @@ func main() {
 			TimeFrame:            env.GetDuration("RATE_LIMITER_TIME_FRAME", 1*time.Minute),
 			Enabled:              env.GetBool("RATE_LIMITER_ENABLED", false),
 		},
+		fanOut: timeline.Config{
+			Workers:       env.GetInt("FANOUT_WORKERS", 4),
+			BufferSize:    env.GetInt("FANOUT_BUFFER_SIZE", 1024),
+			BackfillLimit: env.GetInt("FANOUT_BACKFILL_LIMIT", 100),
+			JobTimeout:    env.GetDuration("FANOUT_JOB_TIMEOUT", 30*time.Second),
+		},
+		feed: store.FeedOptions{
+			IncludeOwnPosts:      env.GetBool("FEED_INCLUDE_OWN_POSTS", true),
+			IncludeReplies:       env.GetBool("FEED_INCLUDE_REPLIES", false),
+			IncludeFollowedTags:  env.GetBool("FEED_INCLUDE_FOLLOWED_TAGS", true),
+			HideSuspendedAuthors: env.GetBool("FEED_HIDE_SUSPENDED_AUTHORS", true),
+		},
+		suggestions: suggestionsConfig{
+			limit:           env.GetInt("SUGGESTIONS_LIMIT", 20),
+			refreshInterval: env.GetDuration("SUGGESTIONS_REFRESH_INTERVAL", time.Hour),
+		},
+		scheduler: schedulerConfig{
+			interval:  env.GetDuration("SCHEDULER_INTERVAL", 30*time.Second),
+			batchSize: env.GetInt("SCHEDULER_BATCH_SIZE", 100),
+		},
+		trash: trashConfig{
+			retention:     env.GetDuration("TRASH_RETENTION", 30*24*time.Hour),
+			purgeInterval: env.GetDuration("TRASH_PURGE_INTERVAL", time.Hour),
+		},
+		stream: streamConfig{
+			hub: realtime.Config{
+				Broker:      env.GetString("STREAM_BROKER", "memory"),
+				BufferSize:  env.GetInt("STREAM_BUFFER_SIZE", 64),
+				HistorySize: env.GetInt("STREAM_HISTORY_SIZE", 1000),
+			},
+			channel:   env.GetString("STREAM_CHANNEL", "social_events"),
+			heartbeat: env.GetDuration("STREAM_HEARTBEAT", 15*time.Second),
+
+			ticketTTL:           env.GetDuration("STREAM_TICKET_TTL", 30*time.Second),
+			ticketPurgeInterval: env.GetDuration("STREAM_TICKET_PURGE_INTERVAL", time.Hour),
+		},
+		gateway: gatewayConfig{
+			messagesPerSecond: env.GetInt("WS_MESSAGES_PER_SECOND", 5),
+			messageBurst:      env.GetInt("WS_MESSAGE_BURST", 10),
+			maxMessageSize:    env.GetInt("WS_MAX_MESSAGE_SIZE", 4096),
+			maxRooms:          env.GetInt("WS_MAX_ROOMS", 20),
+			writeTimeout:      env.GetDuration("WS_WRITE_TIMEOUT", 10*time.Second),
+		},
+		moderation: moderationConfig{
+			autoHideThreshold: env.GetInt("MODERATION_AUTO_HIDE_THRESHOLD", 5),
+		},
+		screening: screeningConfig{
+			rulesRefresh: env.GetDuration("SCREENING_RULES_REFRESH", time.Minute),
+			duplicates: screening.DuplicateConfig{
+				Window:   env.GetDuration("SCREENING_DUPLICATE_WINDOW", time.Hour),
+				FlagAt:   env.GetInt("SCREENING_DUPLICATE_FLAG_AT", 3),
+				RejectAt: env.GetInt("SCREENING_DUPLICATE_REJECT_AT", 5),
+			},
+			classifier: screening.ClassifierConfig{
+				FlagScore:   env.GetFloat("SCREENING_CLASSIFIER_FLAG_SCORE", 0.7),
+				RejectScore: env.GetFloat("SCREENING_CLASSIFIER_REJECT_SCORE", 0.95),
+			},
+			stubScore: env.GetFloat("SCREENING_CLASSIFIER_STUB_SCORE", 0),
+		},
+		export: exportConfig{
+			dir:             env.GetString("EXPORT_DIR", filepath.Join(os.TempDir(), "social-exports")),
+			linkTTL:         env.GetDuration("EXPORT_LINK_TTL", 48*time.Hour),
+			timeout:         env.GetDuration("EXPORT_TIMEOUT", 10*time.Minute),
+			cleanupInterval: env.GetDuration("EXPORT_CLEANUP_INTERVAL", time.Hour),
+		},
+		deletion: accountDeletionConfig{
+			grace: env.GetDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour),
+			// anything but anonymize deletes the content with the account
+			content:       env.GetString("ACCOUNT_DELETION_CONTENT", store.DeletionContentDelete),
+			purgeInterval: env.GetDuration("ACCOUNT_DELETION_PURGE_INTERVAL", time.Hour),
+			batchSize:     env.GetInt("ACCOUNT_DELETION_BATCH_SIZE", 100),
+		},
 	}
 
 	db, err := db.New(
@@ -81,6 +169,7 @@ func main() {
 	log.Info().Msg("DB Connection Established")
 
 	store := store.NewStorage(db)
+	store.TxConfig = cfg.db.tx
 
 	mailer := mailer.NewSmtpMailer(emailCfg)
 
@@ -89,13 +178,57 @@ func main() {
 		cfg.rateLimiter.TimeFrame,
 	)
 
+	fanOut := timeline.NewFanOutWorker(store, cfg.fanOut)
+	fanOut.Start()
+	defer fanOut.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the postgres broker is needed as soon as more than one replica runs
+	var broker realtime.Broker
+	switch cfg.stream.hub.Broker {
+	case "postgres":
+		broker = realtime.NewPostgresBroker(db, cfg.db.addr, cfg.stream.channel)
+	default:
+		broker = realtime.NewMemoryBroker(cfg.stream.hub.BufferSize)
+	}
+
+	hub := realtime.NewHub(broker, cfg.stream.hub)
+	go func() {
+		if err := hub.Run(ctx); err != nil {
+			log.Error().Err(err).Msg("realtime hub stopped")
+		}
+	}()
+
+	screeningRules := screening.NewRuleCache(store.Screening, cfg.screening.rulesRefresh)
+	// an external classifier replaces the stub here
+	classifier := screening.StubClassifier{Score: cfg.screening.stubScore}
+
 	app := &application{
 		config:      cfg,
 		store:       store,
 		mailer:      mailer,
 		rateLimiter: rateLimiter,
+		fanOut:      fanOut,
+		hub:         hub,
+		gateway:     newGateway(),
+		screening: screening.NewPipeline(
+			screening.NewWordFilter(screeningRules),
+			screening.NewDomainBlocklist(screeningRules),
+			screening.NewDuplicateChecker(store.Screening, cfg.screening.duplicates),
+			screening.NewClassifierChecker(classifier, cfg.screening.classifier),
+		),
+		screeningRules: screeningRules,
 	}
 
+	// the jobs enqueue fan-out jobs, deferred after fanOut.Stop they stop before it
+	stopBackgroundJobs := app.startBackgroundJobs(ctx)
+	defer stopBackgroundJobs()
+
 	mux := app.mount()
-	log.Fatal().Err(app.run(mux)).Msg("Error Running Server")
+	if err := app.run(mux); err != nil {
+		// not Fatal, the deferred cleanup still has to run
+		log.Error().Err(err).Msg("Error Running Server")
+	}
 }
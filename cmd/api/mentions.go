@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"html"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shehab910/social/internal/entities"
+	"github.com/shehab910/social/internal/mailer"
+	"github.com/shehab910/social/internal/store"
+)
+
+const mentionExcerptLength = 140
+
+// parseEntities extracts the mentions and hashtags of text, keeping only the
+// mentions of existing users
+func (app *application) parseEntities(ctx context.Context, text string) (entities.List, error) {
+	list := entities.Parse(text)
+
+	userIds, err := app.store.Users.GetIdsByUsernames(ctx, list.Usernames())
+	if err != nil {
+		return nil, err
+	}
+
+	return list.Resolve(userIds), nil
+}
+
+// notifyMentions notifies the mentioned users and emails them in the
+// background, source is either "post" or "comment"
+func (app *application) notifyMentions(ctx context.Context, authorId int64, mentioned []store.User, source string, text string, postId int64) {
+	if len(mentioned) == 0 {
+		return
+	}
+
+	mentionedIds := make([]int64, len(mentioned))
+	for i, user := range mentioned {
+		mentionedIds[i] = user.ID
+	}
+	app.notify(ctx, mentionedIds, authorId, store.NotificationMention, &postId)
+
+	go func() {
+		author, err := app.store.Users.GetById(context.Background(), authorId)
+		if err != nil {
+			log.Error().Err(err).Int64("userId", authorId).Msg("failed to load mention author")
+			return
+		}
+
+		excerpt := []rune(text)
+		if len(excerpt) > mentionExcerptLength {
+			excerpt = append(excerpt[:mentionExcerptLength], '…')
+		}
+
+		for _, user := range mentioned {
+			err := app.mailer.SendMentionEmail(mailer.MentionEmailTemplateData{
+				Username:     user.Username,
+				Email:        user.Email,
+				MentionedBy:  author.Username,
+				Source:       source,
+				Excerpt:      html.EscapeString(string(excerpt)),
+				PostLink:     app.config.clientUrl + "/posts/" + strconv.FormatInt(postId, 10),
+				SupportEmail: app.config.email.SupportEmail,
+			})
+			if err != nil {
+				log.Error().Err(err).Int64("userId", user.ID).Msg("failed to send mention email")
+			}
+		}
+	}()
+}
+
+// notifyPostMentions notifies the users newly mentioned by a post, it runs
+// once the transaction syncing the mentions is committed
+func (app *application) notifyPostMentions(ctx context.Context, post *store.Post, mentioned []store.User) {
+	app.notifyMentions(ctx, post.UserID, mentioned, "post", post.Content, post.ID)
+}
+
+func (app *application) getMentionsHandler(w http.ResponseWriter, r *http.Request) {
+	pfq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+		Tags:   []string{},
+	}
+
+	if err := pfq.Parse(r); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(pfq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+	posts, err := app.store.Mentions.GetMentionedPosts(r.Context(), user.UserId, pfq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shehab910/social/internal/realtime"
+	"github.com/shehab910/social/internal/store"
+)
+
+type conversationKey string
+
+const conversationCtx conversationKey = "conversation"
+
+type CreateConversationPayload struct {
+	// UserIDs are the other members, more than one makes a group
+	UserIDs []int64 `json:"user_ids" validate:"required,min=1,max=9,dive,gt=0"`
+	Title   *string `json:"title" validate:"omitempty,max=100"`
+}
+
+func (app *application) createConversationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateConversationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+
+	memberIds := []int64{}
+	for _, id := range payload.UserIDs {
+		if id != user.UserId && !slices.Contains(memberIds, id) {
+			memberIds = append(memberIds, id)
+		}
+	}
+	if len(memberIds) == 0 {
+		app.badRequestError(w, r, ErrSelfConversation)
+		return
+	}
+
+	for _, memberId := range memberIds {
+		if err := app.canMessage(r.Context(), user.UserId, memberId); err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			case errors.Is(err, ErrBlockedUser), errors.Is(err, ErrDMNotAllowed):
+				app.customErrorResponse(w, r, http.StatusForbidden, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+	}
+
+	conv := &store.Conversation{
+		CreatedBy: user.UserId,
+		IsGroup:   len(memberIds) > 1,
+	}
+	if conv.IsGroup {
+		conv.Title = payload.Title
+	}
+
+	status := http.StatusCreated
+	if err := app.store.Messages.CreateConversation(r.Context(), conv, memberIds); err != nil {
+		// the one-to-one conversation already exists, it's returned as is
+		if !errors.Is(err, store.ErrConflict) {
+			app.internalServerError(w, r, err)
+			return
+		}
+		status = http.StatusOK
+	}
+
+	conversation, err := app.store.Messages.GetConversation(r.Context(), conv.ID, user.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, status, conversation); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// canMessage checks that recipientId exists, that none of the two users
+// blocked the other and that the recipient DM policy lets senderId in
+func (app *application) canMessage(ctx context.Context, senderId int64, recipientId int64) error {
+	recipient, err := app.store.Users.GetById(ctx, recipientId)
+	if err != nil {
+		return err
+	}
+
+	isBlocked, err := app.store.Blocks.IsBlockedEither(ctx, senderId, recipientId)
+	if err != nil {
+		return err
+	}
+	if isBlocked {
+		return ErrBlockedUser
+	}
+
+	if recipient.DMPolicy != store.DMPolicyMutuals {
+		return nil
+	}
+
+	followsRecipient, err := app.store.Followers.IsFollowed(ctx, senderId, recipientId)
+	if err != nil {
+		return err
+	}
+	followedByRecipient, err := app.store.Followers.IsFollowed(ctx, recipientId, senderId)
+	if err != nil {
+		return err
+	}
+	if !followsRecipient || !followedByRecipient {
+		return ErrDMNotAllowed
+	}
+
+	return nil
+}
+
+func (app *application) getConversationsHandler(w http.ResponseWriter, r *http.Request) {
+	cq := store.CursorPaginatedQuery{
+		Limit: 20,
+	}
+
+	if err := cq.Parse(r); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+
+	page, err := app.store.Messages.GetConversations(r.Context(), user.UserId, cq)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			app.badRequestError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getConversationHandler(w http.ResponseWriter, r *http.Request) {
+	conversation := getConversationFromCtx(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, conversation); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	cq := store.CursorPaginatedQuery{
+		Limit: 50,
+	}
+
+	if err := cq.Parse(r); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	conversation := getConversationFromCtx(r)
+	user := app.getCurrentUserFromCtx(r)
+
+	page, err := app.store.Messages.GetMessages(r.Context(), conversation.ID, user.UserId, cq)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			app.badRequestError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type SendMessagePayload struct {
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+func (app *application) sendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	var payload SendMessagePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	conversation := getConversationFromCtx(r)
+	user := app.getCurrentUserFromCtx(r)
+
+	// recipients blocked in a group keep the conversation but don't get the
+	// message pushed. A one-to-one conversation is checked like a new one,
+	// a block or a DM policy change since it was created stops the message
+	recipientIds := []int64{}
+	for _, member := range conversation.Members {
+		if member.User.ID == user.UserId {
+			continue
+		}
+
+		if !conversation.IsGroup {
+			if err := app.canMessage(r.Context(), user.UserId, member.User.ID); err != nil {
+				switch {
+				case errors.Is(err, store.ErrNotFound):
+					app.notFoundResponse(w, r, err)
+				case errors.Is(err, ErrBlockedUser), errors.Is(err, ErrDMNotAllowed):
+					app.customErrorResponse(w, r, http.StatusForbidden, err)
+				default:
+					app.internalServerError(w, r, err)
+				}
+				return
+			}
+			recipientIds = append(recipientIds, member.User.ID)
+			continue
+		}
+
+		isBlocked, err := app.store.Blocks.IsBlockedEither(r.Context(), user.UserId, member.User.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !isBlocked {
+			recipientIds = append(recipientIds, member.User.ID)
+		}
+	}
+
+	msg := &store.Message{
+		ConversationID: conversation.ID,
+		SenderID:       user.UserId,
+		Content:        payload.Content,
+	}
+
+	if err := app.store.Messages.Send(r.Context(), msg); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// the sender gets it too for their other sessions
+	for _, id := range append(recipientIds, user.UserId) {
+		app.publish(r.Context(), realtime.UserTopic(id), realtime.EventMessage, msg)
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, msg); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type MarkConversationReadPayload struct {
+	// MessageID defaults to the latest message
+	MessageID int64 `json:"message_id" validate:"gte=0"`
+}
+
+type messageReadEvent struct {
+	ConversationID    int64 `json:"conversation_id"`
+	UserID            int64 `json:"user_id"`
+	LastReadMessageID int64 `json:"last_read_message_id"`
+}
+
+func (app *application) markConversationReadHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MarkConversationReadPayload
+	// the body is optional
+	if r.ContentLength != 0 {
+		if err := readJSON(w, r, &payload); err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	conversation := getConversationFromCtx(r)
+	user := app.getCurrentUserFromCtx(r)
+
+	lastRead, err := app.store.Messages.MarkRead(r.Context(), conversation.ID, user.UserId, payload.MessageID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	event := messageReadEvent{ConversationID: conversation.ID, UserID: user.UserId, LastReadMessageID: lastRead}
+	for _, member := range conversation.Members {
+		app.publish(r.Context(), realtime.UserTopic(member.User.ID), realtime.EventMessageRead, event)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// conversationContextMiddleware reports the conversations the current user
+// isn't a member of as missing
+func (app *application) conversationContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conversationId, err := strconv.ParseInt(chi.URLParam(r, "conversation_id"), 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, ErrWrongFormat)
+			return
+		}
+
+		user := app.getCurrentUserFromCtx(r)
+
+		conversation, err := app.store.Messages.GetConversation(r.Context(), conversationId, user.UserId)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				app.notFoundResponse(w, r, err)
+				return
+			}
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), conversationCtx, conversation)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getConversationFromCtx(r *http.Request) *store.Conversation {
+	conversation, _ := r.Context().Value(conversationCtx).(*store.Conversation)
+	return conversation
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"slices"
 
+	"github.com/rs/zerolog/log"
+	"github.com/shehab910/social/internal/store"
 	"github.com/shehab910/social/internal/utils"
 )
 
@@ -20,6 +24,56 @@ func (app *application) RateLimiterMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// streamTicketMiddleware authenticates the long lived connections by the
+// ticket query param, browser EventSource and WebSocket can't set headers.
+// Unlike the token a ticket is short lived and single use, so it's harmless
+// in access logs. Requests without a ticket go through AuthenticateMiddleware
+func (app *application) streamTicketMiddleware(next http.Handler) http.Handler {
+	authenticated := app.AuthenticateMiddleware(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ticket := r.URL.Query().Get("ticket")
+		if ticket == "" {
+			authenticated.ServeHTTP(w, r)
+			return
+		}
+
+		userId, err := app.store.StreamTickets.Consume(r.Context(), ticket)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				app.unauthorizedResponse(w, r, err)
+				return
+			}
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		user, err := app.store.Users.GetById(r.Context(), userId)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				app.unauthorizedResponse(w, r, err)
+				return
+			}
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !user.Verified {
+			app.unauthorizedResponse(w, r, nil)
+			return
+		}
+
+		app.serveAuthenticated(w, r, next, utils.TokenClaims{
+			Email:      user.Email,
+			UserId:     user.ID,
+			Username:   user.Username,
+			ImgUrl:     user.ImgUrl,
+			Role:       user.Role,
+			IsVerified: user.Verified,
+		})
+	})
+}
+
 type contextKey string
 
 const currUserCtx contextKey = "authUser"
@@ -50,12 +104,104 @@ func (app *application) AuthenticateMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), currUserCtx, utils.ParseClaims(claims))
+		app.serveAuthenticated(w, r, next, utils.ParseClaims(claims))
+	})
+}
+
+// serveAuthenticated serves next as user unless the account is suspended or
+// pending deletion. It's checked on every request so a suspension or a
+// deletion request cuts off the issued tokens
+func (app *application) serveAuthenticated(w http.ResponseWriter, r *http.Request, next http.Handler, user utils.TokenClaims) {
+	status, err := app.store.Users.GetStatus(r.Context(), user.UserId)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.unauthorizedResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+	if status.Suspension != nil {
+		app.suspendedResponse(w, r, status.Suspension)
+		return
+	}
+	if status.DeletionRequestedAt != nil {
+		app.customErrorResponse(w, r, http.StatusUnauthorized, ErrPendingDeletion)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), currUserCtx, user)
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// requireRoleMiddleware lets through the authenticated users having one of
+// roles, the role is read from the db so demotions apply before the token expires
+func (app *application) requireRoleMiddleware(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := app.store.Users.GetById(r.Context(), app.getCurrentUserFromCtx(r).UserId)
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					app.unauthorizedResponse(w, r, err)
+					return
+				}
+				app.internalServerError(w, r, err)
+				return
+			}
+
+			if !slices.Contains(roles, user.Role) {
+				app.customErrorResponse(w, r, http.StatusForbidden, ErrForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// OptionalAuthenticateMiddleware attaches the current user to the context when a
+// valid token is sent, otherwise the request goes through anonymously
+func (app *application) OptionalAuthenticateMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := r.Header.Get("Authorization")
+		if tokenString == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, err := utils.ValidateToken(tokenString, app.config.jwtSecret)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		isVerified, ok := claims["is_verified"].(bool)
+		_, hasUserId := claims["userId"].(float64)
+		if !ok || !isVerified || !hasUserId {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user := utils.ParseClaims(claims)
+
+		// suspended users and accounts pending deletion browse like anonymous viewers
+		status, err := app.store.Users.GetStatus(r.Context(), user.UserId)
+		if err != nil || status.Suspension != nil || status.DeletionRequestedAt != nil {
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				log.Error().Err(err).Int64("userId", user.UserId).Msg("failed to check account status")
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), currUserCtx, user)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// getCurrentUserFromCtx returns empty claims (UserId = 0) for anonymous requests
 func (app *application) getCurrentUserFromCtx(r *http.Request) utils.TokenClaims {
 	user, _ := r.Context().Value(currUserCtx).(utils.TokenClaims)
 	return user
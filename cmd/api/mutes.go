@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shehab910/social/internal/store"
+)
+
+func (app *application) getMutesHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUserFromCtx(r)
+
+	mutes, err := app.store.Mutes.GetByUserId(r.Context(), user.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, mutes); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) muteTermHandler(kind store.MuteKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// validated once normalized so a whitespace only word can't be muted
+		term := store.NormalizeMuteTerm(kind, chi.URLParam(r, "term"))
+		if err := Validate.Var(term, "required,max=50"); err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+
+		user := app.getCurrentUserFromCtx(r)
+
+		if err := app.store.Mutes.MuteTerm(r.Context(), user.UserId, kind, term); err != nil {
+			if errors.Is(err, store.ErrConflict) {
+				app.conflictResponse(w, r, err)
+				return
+			}
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (app *application) unmuteTermHandler(kind store.MuteKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := app.getCurrentUserFromCtx(r)
+
+		if err := app.store.Mutes.UnmuteTerm(r.Context(), user.UserId, kind, chi.URLParam(r, "term")); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (app *application) muteUserHandler(w http.ResponseWriter, r *http.Request) {
+	mutedUserId, err := strconv.ParseInt(chi.URLParam(r, "muted_user_id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, ErrWrongFormat)
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+	if mutedUserId == user.UserId {
+		app.customErrorResponse(w, r, http.StatusBadRequest, errors.New("you can't mute yourself"))
+		return
+	}
+
+	if _, err := app.store.Users.GetById(r.Context(), mutedUserId); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Mutes.MuteUser(r.Context(), user.UserId, mutedUserId); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			app.conflictResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unmuteUserHandler(w http.ResponseWriter, r *http.Request) {
+	mutedUserId, err := strconv.ParseInt(chi.URLParam(r, "muted_user_id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, ErrWrongFormat)
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+
+	if err := app.store.Mutes.UnmuteUser(r.Context(), user.UserId, mutedUserId); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/shehab910/social/internal/realtime"
+	"github.com/shehab910/social/internal/store"
+)
+
+type notificationEvent struct {
+	Type    store.NotificationType `json:"type"`
+	PostID  *int64                 `json:"post_id"`
+	ActorID int64                  `json:"actor_id"`
+}
+
+// notify records a notification and pushes it to the connected recipients
+// without failing the request that produced it
+func (app *application) notify(ctx context.Context, recipientIds []int64, actorId int64, kind store.NotificationType, postId *int64) {
+	notified, err := app.store.Notifications.Create(ctx, recipientIds, actorId, kind, postId)
+	if err != nil {
+		log.Error().Err(err).Str("type", string(kind)).Int64("actorId", actorId).Msg("failed to create notification")
+		return
+	}
+
+	event := notificationEvent{Type: kind, PostID: postId, ActorID: actorId}
+	for _, id := range notified {
+		app.publish(ctx, realtime.UserTopic(id), realtime.EventNotification, event)
+	}
+}
+
+func (app *application) getNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	cq := store.CursorPaginatedQuery{
+		Limit: 20,
+	}
+
+	if err := cq.Parse(r); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+
+	page, err := app.store.Notifications.GetByUserId(r.Context(), user.UserId, cq)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			app.badRequestError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getUnreadNotificationsCountHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUserFromCtx(r)
+
+	count, err := app.store.Notifications.GetUnreadCount(r.Context(), user.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, map[string]int{"count": count}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) markNotificationReadHandler(w http.ResponseWriter, r *http.Request) {
+	notificationId, err := strconv.ParseInt(chi.URLParam(r, "notification_id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, ErrWrongFormat)
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+
+	if err := app.store.Notifications.MarkRead(r.Context(), user.UserId, notificationId); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) markAllNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUserFromCtx(r)
+
+	if err := app.store.Notifications.MarkAllRead(r.Context(), user.UserId); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
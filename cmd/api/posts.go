@@ -5,9 +5,14 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/shehab910/social/internal/realtime"
+	"github.com/shehab910/social/internal/screening"
 	"github.com/shehab910/social/internal/store"
+	"github.com/shehab910/social/internal/timeline"
+	"github.com/shehab910/social/internal/utils"
 )
 
 type postKey string
@@ -15,9 +20,13 @@ type postKey string
 const postCtx postKey = "post"
 
 type CreatePostPayload struct {
-	Title   string   `json:"title" validate:"required,max=100"`
-	Content string   `json:"content" validate:"required,max=1000"`
-	Tags    []string `json:"tags" validate:"dive,max=20"`
+	Title      string   `json:"title" validate:"required,max=100"`
+	Content    string   `json:"content" validate:"required,max=1000"`
+	Tags       []string `json:"tags" validate:"dive,max=20"`
+	Visibility string   `json:"visibility" validate:"omitempty,oneof=public followers unlisted private"`
+	// Draft saves the post without publishing it, ignored if PublishAt is set
+	Draft     bool    `json:"draft"`
+	PublishAt *string `json:"publish_at" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
 }
 
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -32,38 +41,269 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if payload.PublishAt != nil {
+		if err := validatePublishAt(*payload.PublishAt); err != nil {
+			app.unProcessableContent(w, r, err)
+			return
+		}
+	}
+
 	user := app.getCurrentUserFromCtx(r)
 
+	decision, ok := app.screenContent(w, r, screening.Content{
+		Kind:     screening.KindPost,
+		AuthorID: user.UserId,
+		Title:    payload.Title,
+		Text:     payload.Content,
+	})
+	if !ok {
+		return
+	}
+
+	postEntities, err := app.parseEntities(r.Context(), payload.Content)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		UserID:  user.UserId,
+		Title:      payload.Title,
+		Content:    payload.Content,
+		Entities:   postEntities,
+		Tags:       payload.Tags,
+		Visibility: payload.Visibility,
+		Status:     store.StatusPublished,
+		PublishAt:  payload.PublishAt,
+		UserID:     user.UserId,
+	}
+
+	switch {
+	case payload.PublishAt != nil:
+		post.Status = store.StatusScheduled
+	case payload.Draft:
+		post.Status = store.StatusDraft
 	}
 
-	if err := app.store.Posts.Create(r.Context(), post); err != nil {
+	// the post and its mentions are saved together, unpublished posts get
+	// their mentions once published
+	var mentioned []store.User
+	err = app.store.WithTx(r.Context(), func(tx *store.Storage) error {
+		if err := tx.Posts.Create(r.Context(), post); err != nil {
+			return err
+		}
+		if post.Status != store.StatusPublished {
+			return nil
+		}
+
+		var err error
+		mentioned, err = tx.Mentions.SyncPost(r.Context(), post)
+		return err
+	})
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	app.flagForReview(r.Context(), decision, store.ReportTargetPost, post.ID)
+
+	if post.Status == store.StatusPublished {
+		app.onPostPublished(r.Context(), post, mentioned)
+	}
+
 	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
 
 	}
 }
 
-func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
+// onPostPublished runs the side effects of a post becoming visible, whether it
+// was created published or published later from a draft or schedule. The
+// mentions are synced by the caller in the transaction publishing the post,
+// mentioned are the users it newly mentions
+func (app *application) onPostPublished(ctx context.Context, post *store.Post, mentioned []store.User) {
+	app.fanOut.Enqueue(timeline.Job{Kind: timeline.JobFanOut, PostID: post.ID})
+	app.notifyPostMentions(ctx, post, mentioned)
+
+	// every other level reaches at least the author's followers feed
+	if post.Visibility != store.VisibilityPrivate {
+		app.publishFrom(ctx, realtime.AuthorTopic(post.UserID), realtime.EventFeedPost, post.UserID, feedPostEvent{PostID: post.ID, UserID: post.UserID})
+	}
+}
+
+type feedPostEvent struct {
+	PostID int64 `json:"post_id"`
+	UserID int64 `json:"user_id"`
+}
+
+func validatePublishAt(publishAt string) error {
+	t, err := utils.ParseTime(publishAt)
+	if err != nil {
+		return err
+	}
+	if !t.After(time.Now()) {
+		return ErrPublishAtInPast
+	}
+	return nil
+}
+
+func (app *application) publishPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	user := app.getCurrentUserFromCtx(r)
+	if post.UserID != user.UserId {
+		app.customErrorResponse(w, r, http.StatusForbidden, errors.New("you are not allowed to publish this post"))
+		return
+	}
+
+	var mentioned []store.User
+	err := app.store.WithTx(r.Context(), func(tx *store.Storage) error {
+		if err := tx.Posts.Publish(r.Context(), post); err != nil {
+			return err
+		}
+
+		var err error
+		mentioned, err = tx.Mentions.SyncPost(r.Context(), post)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.conflictResponse(w, r, errors.New("post already published"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.onPostPublished(r.Context(), post, mentioned)
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type SchedulePostPayload struct {
+	// PublishAt set to null moves the post back to drafts
+	PublishAt *string `json:"publish_at" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+}
+
+func (app *application) schedulePostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
 
-	// comments, err := app.store.Comments.GetByPostIdWithUser(r.Context(), post.ID)
-	// if err != nil {
-	// 	app.internalServerError(w, r, err)
-	// 	return
-	// }
+	user := app.getCurrentUserFromCtx(r)
+	if post.UserID != user.UserId {
+		app.customErrorResponse(w, r, http.StatusForbidden, errors.New("you are not allowed to schedule this post"))
+		return
+	}
+
+	var payload SchedulePostPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
 
-	// post.Comments = comments
+	if payload.PublishAt != nil {
+		if err := validatePublishAt(*payload.PublishAt); err != nil {
+			app.unProcessableContent(w, r, err)
+			return
+		}
+	}
+
+	if err := app.store.Posts.Schedule(r.Context(), post, payload.PublishAt); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.conflictResponse(w, r, errors.New("post already published"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
 
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getTrashHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUserFromCtx(r)
+
+	posts, err := app.store.Posts.GetTrashByUserId(r.Context(), user.UserId, app.config.trash.retention)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) restorePostHandler(w http.ResponseWriter, r *http.Request) {
+	postId, err := strconv.ParseInt(chi.URLParam(r, "post_id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, errors.New("wrong post id"))
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+
+	// only the author's posts still within the retention window can be restored
+	if err := app.store.Posts.Restore(r.Context(), postId, user.UserId, app.config.trash.retention); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	post, err := app.store.Posts.GetByIdWithMeta(r.Context(), postId, user.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getDraftsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUserFromCtx(r)
+
+	drafts, err := app.store.Posts.GetUnpublishedByUserId(r.Context(), user.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, drafts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	viewer := app.getCurrentUserFromCtx(r)
+
+	postWithMeta, err := app.store.Posts.GetByIdWithMeta(r.Context(), post.ID, viewer.UserId)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, postWithMeta); err != nil {
+		app.internalServerError(w, r, err)
 		return
 	}
 }
@@ -75,6 +315,7 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// staff delete others' posts through deletePostAsStaffHandler
 	user := app.getCurrentUserFromCtx(r)
 	if post.UserID != user.UserId {
 		app.customErrorResponse(w, r, http.StatusForbidden, errors.New("you are not allowed to delete this post"))
@@ -90,12 +331,56 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		}
 		return
 	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deletePostAsStaffHandler lets moderators and admins delete any post. It
+// skips the visibility checks of postContextMiddleware, the posts to remove
+// are often hidden, private or written by someone blocking the moderator
+func (app *application) deletePostAsStaffHandler(w http.ResponseWriter, r *http.Request) {
+	postId, err := strconv.ParseInt(chi.URLParam(r, "post_id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, errors.New("wrong post id"))
+		return
+	}
+
+	post, err := app.store.Posts.GetByIdWithUser(r.Context(), postId)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Posts.DeleteById(r.Context(), post.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditEvent{
+		Action:     store.AuditPostDelete,
+		ActorID:    app.getCurrentUserFromCtx(r).UserId,
+		TargetType: store.AuditTargetPost,
+		TargetID:   post.ID,
+		Before:     post,
+	})
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
 type UpdatePostPayload struct {
-	Title   *string `json:"title" validate:"omitempty,max=100"`
-	Content *string `json:"content" validate:"omitempty,max=1000"`
+	Title      *string `json:"title" validate:"omitempty,max=100"`
+	Content    *string `json:"content" validate:"omitempty,max=1000"`
+	Visibility *string `json:"visibility" validate:"omitempty,oneof=public followers unlisted private"`
 }
 
 func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
@@ -128,6 +413,13 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 	if payload.Content != nil {
 		isPayloadEmpty = false
 		post.Content = *payload.Content
+
+		postEntities, err := app.parseEntities(r.Context(), post.Content)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		post.Entities = postEntities
 	}
 
 	if payload.Title != nil {
@@ -135,16 +427,55 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		post.Title = *payload.Title
 	}
 
+	if payload.Visibility != nil {
+		isPayloadEmpty = false
+		post.Visibility = *payload.Visibility
+	}
+
 	if isPayloadEmpty {
 		app.badRequestError(w, r, ErrEmptyJSONBody)
 		return
 	}
 
-	if err := app.store.Posts.Update(r.Context(), post); err != nil {
+	// a visibility change alone has no new text to screen
+	decision := screening.Decision{Verdict: screening.Allow}
+	if payload.Content != nil || payload.Title != nil {
+		var ok bool
+		decision, ok = app.screenContent(w, r, screening.Content{
+			Kind:     screening.KindPost,
+			AuthorID: user.UserId,
+			PostID:   post.ID,
+			Title:    post.Title,
+			Text:     post.Content,
+		})
+		if !ok {
+			return
+		}
+	}
+
+	// unpublished posts get their mentions synced once published, a content
+	// or visibility change may add or drop mentioned users
+	var mentioned []store.User
+	err := app.store.WithTx(r.Context(), func(tx *store.Storage) error {
+		if err := tx.Posts.Update(r.Context(), post); err != nil {
+			return err
+		}
+		if post.Status != store.StatusPublished {
+			return nil
+		}
+
+		var err error
+		mentioned, err = tx.Mentions.SyncPost(r.Context(), post)
+		return err
+	})
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	app.flagForReview(r.Context(), decision, store.ReportTargetPost, post.ID)
+	app.notifyPostMentions(r.Context(), post, mentioned)
+
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -172,11 +503,53 @@ func (app *application) postContextMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// posts the viewer isn't allowed to see are reported as missing
+		viewer := app.getCurrentUserFromCtx(r)
+		canView, err := app.canViewPost(rCtx, viewer.UserId, post)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !canView {
+			app.notFoundResponse(w, r, ErrPostNotVisible)
+			return
+		}
+
 		ctx := context.WithValue(rCtx, postCtx, post)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// canViewPost applies the account privacy and the post visibility level for
+// the viewer (0 if anonymous)
+func (app *application) canViewPost(ctx context.Context, viewerId int64, post *store.Post) (bool, error) {
+	if post.UserID == viewerId {
+		return true, nil
+	}
+
+	// drafts, scheduled and moderated posts are only visible to their author
+	if post.Status != store.StatusPublished || post.Hidden {
+		return false, nil
+	}
+
+	canViewAuthor, err := app.canViewUserContent(ctx, viewerId, &post.User)
+	if err != nil || !canViewAuthor {
+		return false, err
+	}
+
+	switch post.Visibility {
+	case store.VisibilityPublic, store.VisibilityUnlisted:
+		return true, nil
+	case store.VisibilityFollowers:
+		if viewerId == 0 {
+			return false, nil
+		}
+		return app.store.Followers.IsFollowed(ctx, viewerId, post.UserID)
+	default:
+		return false, nil
+	}
+}
+
 func getPostFromCtx(r *http.Request) *store.Post {
 	//TODO: check error handling here
 	post, _ := r.Context().Value(postCtx).(*store.Post)
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/shehab910/social/internal/realtime"
+	"github.com/shehab910/social/internal/store"
+)
+
+type CreateReportPayload struct {
+	TargetType string  `json:"target_type" validate:"required,oneof=post comment user"`
+	TargetID   int64   `json:"target_id" validate:"required,gt=0"`
+	Reason     string  `json:"reason" validate:"required,oneof=spam harassment hate violence nudity misinformation other"`
+	Details    *string `json:"details" validate:"omitempty,max=1000"`
+}
+
+func (app *application) createReportHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateReportPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+	ctx := r.Context()
+
+	ownerId, err := app.store.Reports.GetTargetOwnerId(ctx, payload.TargetType, payload.TargetID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if ownerId == user.UserId {
+		app.badRequestError(w, r, ErrSelfReport)
+		return
+	}
+
+	// content the reporter can't see is reported as missing, so reports can't
+	// probe private or hidden content
+	canView, err := app.canViewReportTarget(ctx, user.UserId, payload.TargetType, payload.TargetID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !canView {
+		app.notFoundResponse(w, r, ErrPostNotVisible)
+		return
+	}
+
+	report := &store.Report{
+		ReporterID: &user.UserId,
+		TargetType: payload.TargetType,
+		TargetID:   payload.TargetID,
+		Reason:     payload.Reason,
+		Details:    payload.Details,
+	}
+
+	hidden, err := app.store.Reports.Create(ctx, report, app.config.moderation.autoHideThreshold)
+	if err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			app.conflictResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if hidden {
+		log.Info().
+			Str("targetType", report.TargetType).
+			Int64("targetId", report.TargetID).
+			Int("reports", report.TargetReports).
+			Msg("content auto-hidden after reports")
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, report); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// canViewReportTarget applies the post visibility to posts and comments, users
+// can be reported by anyone who can reach their profile
+func (app *application) canViewReportTarget(ctx context.Context, viewerId int64, targetType string, targetId int64) (bool, error) {
+	postId := targetId
+	switch targetType {
+	case store.ReportTargetUser:
+		return true, nil
+	case store.ReportTargetComment:
+		var err error
+		postId, err = app.store.Comments.GetPostId(ctx, targetId)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	post, err := app.store.Posts.GetByIdWithUser(ctx, postId)
+	if err != nil {
+		return false, err
+	}
+
+	return app.canViewPost(ctx, viewerId, post)
+}
+
+func (app *application) getReportsQueueHandler(w http.ResponseWriter, r *http.Request) {
+	cq := store.CursorPaginatedQuery{
+		Limit: 20,
+	}
+
+	if err := cq.Parse(r); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	// the queue shows the pending reports unless asked otherwise
+	filter := store.ReportFilter{
+		Status:     r.URL.Query().Get("status"),
+		TargetType: r.URL.Query().Get("target_type"),
+	}
+	if filter.Status == "" {
+		filter.Status = store.ReportStatusOpen
+	}
+	if filter.Status == "all" {
+		filter.Status = ""
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(filter); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	page, err := app.store.Reports.GetQueue(r.Context(), filter, cq)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			app.badRequestError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) claimReportHandler(w http.ResponseWriter, r *http.Request) {
+	reportId, err := strconv.ParseInt(chi.URLParam(r, "report_id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, ErrWrongFormat)
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+
+	if err := app.store.Reports.Claim(r.Context(), reportId, user.UserId); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.customErrorResponse(w, r, http.StatusConflict, errors.New("report is claimed by another moderator or already closed"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditEvent{
+		Action:     store.AuditReportClaim,
+		ActorID:    user.UserId,
+		TargetType: store.AuditTargetReport,
+		TargetID:   reportId,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type ResolveReportPayload struct {
+	Action string  `json:"action" validate:"required,oneof=remove_content warn suspend_user dismiss"`
+	Note   *string `json:"note" validate:"omitempty,max=1000"`
+	// SuspendedUntil is required by the suspend_user action
+	SuspendedUntil *time.Time `json:"suspended_until" validate:"required_if=Action suspend_user"`
+}
+
+func (app *application) resolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	reportId, err := strconv.ParseInt(chi.URLParam(r, "report_id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, ErrWrongFormat)
+		return
+	}
+
+	var payload ResolveReportPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if payload.SuspendedUntil != nil && !payload.SuspendedUntil.After(time.Now()) {
+		app.unProcessableContent(w, r, errors.New("suspended_until must be in the future"))
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+	ctx := r.Context()
+
+	report, err := app.store.Reports.GetById(ctx, reportId)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	resolution := store.Resolution{
+		Action:         payload.Action,
+		Note:           payload.Note,
+		SuspendedUntil: payload.SuspendedUntil,
+	}
+
+	if err := app.store.Reports.Resolve(ctx, report, user.UserId, resolution); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrInvalidModerationAction):
+			app.unProcessableContent(w, r, err)
+		case errors.Is(err, store.ErrSuspendStaff):
+			app.customErrorResponse(w, r, http.StatusForbidden, err)
+		case errors.Is(err, store.ErrConflict):
+			app.customErrorResponse(w, r, http.StatusConflict, errors.New("report is claimed by another moderator or already closed"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditEvent{
+		Action:     store.AuditReportResolve,
+		ActorID:    user.UserId,
+		TargetType: store.AuditTargetReport,
+		TargetID:   report.ID,
+		Before:     report,
+		After:      payload,
+	})
+
+	if payload.Action == store.ModerationWarn || payload.Action == store.ModerationSuspendUser {
+		if ownerId, err := app.store.Reports.GetTargetOwnerId(ctx, report.TargetType, report.TargetID); err == nil {
+			if payload.Action == store.ModerationSuspendUser {
+				app.endUserSessions(r, ownerId, realtime.EventSuspended)
+			} else {
+				app.publish(ctx, realtime.UserTopic(ownerId), realtime.EventWarning, map[string]any{
+					"report_id": report.ID,
+					"reason":    report.Reason,
+					"note":      payload.Note,
+				})
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) getModerationActionsHandler(w http.ResponseWriter, r *http.Request) {
+	cq := store.CursorPaginatedQuery{
+		Limit: 20,
+	}
+
+	if err := cq.Parse(r); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	page, err := app.store.Reports.GetActions(r.Context(), cq)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			app.badRequestError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
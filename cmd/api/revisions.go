@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shehab910/social/internal/diff"
+	"github.com/shehab910/social/internal/store"
+)
+
+type PostRevisionWithDiff struct {
+	store.PostRevision
+	// diffs against the previous revision, empty for the first one
+	TitleDiff   []diff.Op `json:"title_diff,omitempty"`
+	ContentDiff []diff.Op `json:"content_diff,omitempty"`
+}
+
+func (app *application) getPostRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	revisions, err := app.store.Posts.GetRevisions(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	withDiffs := make([]PostRevisionWithDiff, len(revisions))
+	for i, rev := range revisions {
+		withDiffs[i].PostRevision = rev
+		if i == 0 {
+			continue
+		}
+		prev := revisions[i-1]
+		withDiffs[i].TitleDiff = diff.Words(prev.Title, rev.Title)
+		withDiffs[i].ContentDiff = diff.Words(prev.Content, rev.Content)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, withDiffs); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// restorePostRevisionHandler restores an old revision as a new edit, so the
+// history is never rewritten
+func (app *application) restorePostRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	user := app.getCurrentUserFromCtx(r)
+	if post.UserID != user.UserId {
+		app.customErrorResponse(w, r, http.StatusForbidden, errors.New("you are not allowed to modify this post"))
+		return
+	}
+
+	revision, err := strconv.Atoi(chi.URLParam(r, "revision"))
+	if err != nil {
+		app.badRequestError(w, r, ErrWrongFormat)
+		return
+	}
+
+	rev, err := app.store.Posts.GetRevision(r.Context(), post.ID, revision)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	post.Title = rev.Title
+	post.Content = rev.Content
+	post.Tags = rev.Tags
+
+	if err := app.store.Posts.Update(r.Context(), post); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
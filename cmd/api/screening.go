@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/shehab910/social/internal/screening"
+	"github.com/shehab910/social/internal/store"
+)
+
+type screeningConfig struct {
+	rulesRefresh time.Duration
+	duplicates   screening.DuplicateConfig
+	classifier   screening.ClassifierConfig
+	// stubScore is the score given by the local classifier stub
+	stubScore float64
+}
+
+// screenContent runs the screening pipeline on the content, it writes the
+// response and returns false when the content is rejected
+func (app *application) screenContent(w http.ResponseWriter, r *http.Request, content screening.Content) (screening.Decision, bool) {
+	decision := app.screening.Run(r.Context(), content)
+	if decision.Verdict == screening.Reject {
+		app.unProcessableContent(w, r, fmt.Errorf("%w: %s", ErrContentRejected, decision.Reason()))
+		return decision, false
+	}
+
+	return decision, true
+}
+
+// flagForReview files a report on flagged content so it shows up in the
+// moderation queue, without failing the request that published it
+func (app *application) flagForReview(ctx context.Context, decision screening.Decision, targetType string, targetId int64) {
+	if decision.Verdict != screening.Flag {
+		return
+	}
+
+	details := decision.Reason()
+	report := &store.Report{
+		TargetType: targetType,
+		TargetID:   targetId,
+		Reason:     store.ReportReasonScreening,
+		Details:    &details,
+	}
+
+	// screening reports never auto-hide the content, a moderator decides
+	if _, err := app.store.Reports.Create(ctx, report, 0); err != nil {
+		log.Error().Err(err).Str("targetType", targetType).Int64("targetId", targetId).Msg("failed to flag content for review")
+	}
+}
+
+func (app *application) getScreeningRulesHandler(w http.ResponseWriter, r *http.Request) {
+	rules, err := app.store.Screening.GetRules(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, rules); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type CreateScreeningRulePayload struct {
+	Kind    string  `json:"kind" validate:"required,oneof=word regex domain"`
+	Pattern string  `json:"pattern" validate:"required,max=255"`
+	Action  string  `json:"action" validate:"required,oneof=flag reject"`
+	Reason  *string `json:"reason" validate:"omitempty,max=255"`
+}
+
+func (app *application) createScreeningRuleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateScreeningRulePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if payload.Kind == store.ScreeningRuleDomain {
+		payload.Pattern = strings.ToLower(strings.TrimPrefix(payload.Pattern, "."))
+		if err := Validate.Var(payload.Pattern, "fqdn"); err != nil {
+			app.unProcessableContent(w, r, errors.New("pattern must be a domain name"))
+			return
+		}
+	} else if _, err := screening.CompileRule(payload.Kind, payload.Pattern); err != nil {
+		app.unProcessableContent(w, r, err)
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+
+	rule := &store.ScreeningRule{
+		Kind:      payload.Kind,
+		Pattern:   payload.Pattern,
+		Action:    payload.Action,
+		Reason:    payload.Reason,
+		CreatedBy: &user.UserId,
+	}
+
+	if err := app.store.Screening.CreateRule(r.Context(), rule); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			app.conflictResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.screeningRules.Invalidate()
+
+	app.audit(r, auditEvent{
+		Action:     store.AuditScreeningRuleAdd,
+		ActorID:    user.UserId,
+		TargetType: store.AuditTargetScreeningRule,
+		TargetID:   rule.ID,
+		After:      rule,
+	})
+
+	if err := app.jsonResponse(w, http.StatusCreated, rule); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) deleteScreeningRuleHandler(w http.ResponseWriter, r *http.Request) {
+	ruleId, err := strconv.ParseInt(chi.URLParam(r, "rule_id"), 10, 64)
+	if err != nil {
+		app.badRequestError(w, r, ErrWrongFormat)
+		return
+	}
+
+	rule, err := app.store.Screening.DeleteRule(r.Context(), ruleId)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.screeningRules.Invalidate()
+
+	app.audit(r, auditEvent{
+		Action:     store.AuditScreeningRuleDel,
+		ActorID:    app.getCurrentUserFromCtx(r).UserId,
+		TargetType: store.AuditTargetScreeningRule,
+		TargetID:   ruleId,
+		Before:     rule,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shehab910/social/internal/realtime"
+	"github.com/shehab910/social/internal/store"
+)
+
+// publish sends a realtime event without failing the request that produced it
+func (app *application) publish(ctx context.Context, topic string, eventType string, data any) {
+	if err := app.hub.Publish(ctx, topic, eventType, data); err != nil {
+		log.Error().Err(err).Str("topic", topic).Str("type", eventType).Msg("failed to publish realtime event")
+	}
+}
+
+// publishFrom is publish for the events produced by a user
+func (app *application) publishFrom(ctx context.Context, topic string, eventType string, actorId int64, data any) {
+	if err := app.hub.PublishFrom(ctx, topic, eventType, actorId, data); err != nil {
+		log.Error().Err(err).Str("topic", topic).Str("type", eventType).Msg("failed to publish realtime event")
+	}
+}
+
+type blockChecker interface {
+	IsBlockedEither(ctx context.Context, userId int64, otherUserId int64) (bool, error)
+}
+
+// blockFilter drops the events produced by users blocking the viewer or
+// blocked by them, the post topics reach every viewer of the post. Answers are
+// cached for the connection, it's only used by the goroutine writing it
+type blockFilter struct {
+	blocks   blockChecker
+	viewerId int64
+	blocked  map[int64]bool
+}
+
+func (app *application) newBlockFilter(viewerId int64) *blockFilter {
+	return &blockFilter{blocks: app.store.Blocks, viewerId: viewerId, blocked: map[int64]bool{}}
+}
+
+// hides reports whether the event must not reach the viewer, it fails closed
+func (f *blockFilter) hides(ctx context.Context, event realtime.Event) bool {
+	if event.ActorID == 0 || event.ActorID == f.viewerId {
+		return false
+	}
+
+	blocked, ok := f.blocked[event.ActorID]
+	if !ok {
+		var err error
+		blocked, err = f.blocks.IsBlockedEither(ctx, f.viewerId, event.ActorID)
+		if err != nil {
+			log.Error().Err(err).Int64("userId", f.viewerId).Int64("actorId", event.ActorID).Msg("failed to check realtime event blocks")
+			return true
+		}
+		f.blocked[event.ActorID] = blocked
+	}
+
+	return blocked
+}
+
+// streamTopics returns the topics of the user's notifications, the authors
+// in their feed and optionally the comments of the post they're viewing.
+// Follows made after connecting are picked up on the next reconnect
+func (app *application) streamTopics(r *http.Request, userId int64) ([]string, error) {
+	topics := []string{realtime.UserTopic(userId)}
+	if app.config.feed.IncludeOwnPosts {
+		topics = append(topics, realtime.AuthorTopic(userId))
+	}
+
+	followingIds, err := app.store.Followers.GetFollowingIds(r.Context(), userId)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range followingIds {
+		topics = append(topics, realtime.AuthorTopic(id))
+	}
+
+	postIdParam := r.URL.Query().Get("post_id")
+	if postIdParam == "" {
+		return topics, nil
+	}
+
+	postId, err := strconv.ParseInt(postIdParam, 10, 64)
+	if err != nil {
+		return nil, ErrWrongFormat
+	}
+
+	post, err := app.store.Posts.GetByIdWithUser(r.Context(), postId)
+	if err != nil {
+		return nil, err
+	}
+
+	canView, err := app.canViewPost(r.Context(), userId, post)
+	if err != nil {
+		return nil, err
+	}
+	if !canView {
+		return nil, ErrPostNotVisible
+	}
+
+	return append(topics, realtime.PostTopic(postId)), nil
+}
+
+func (app *application) streamHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUserFromCtx(r)
+
+	topics, err := app.streamTopics(r, user.UserId)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrWrongFormat):
+			app.badRequestError(w, r, err)
+		case errors.Is(err, store.ErrNotFound), errors.Is(err, ErrPostNotVisible):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// browsers send Last-Event-ID when reconnecting, the query param covers
+	// clients resuming from a new EventSource
+	lastEventIdParam := r.Header.Get("Last-Event-ID")
+	if lastEventIdParam == "" {
+		lastEventIdParam = r.URL.Query().Get("last_event_id")
+	}
+	var lastEventId int64
+	if lastEventIdParam != "" {
+		lastEventId, err = strconv.ParseInt(lastEventIdParam, 10, 64)
+		if err != nil {
+			app.badRequestError(w, r, ErrWrongFormat)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	// the server write timeout would cut the stream
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	sub, replay := app.hub.Subscribe(topics, lastEventId)
+	defer app.hub.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	filter := app.newBlockFilter(user.UserId)
+
+	for _, event := range replay {
+		if filter.hides(r.Context(), event) {
+			continue
+		}
+		if err := writeEvent(w, event); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(app.config.stream.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			// the hub dropped the subscriber for falling behind, the client
+			// reconnects and resumes from its last event
+			if !ok {
+				return
+			}
+			if filter.hides(r.Context(), event) {
+				continue
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			if realtime.EndsSession(event.Type) {
+				rc.Flush()
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+type streamTicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// createStreamTicketHandler issues the single use ticket that authenticates
+// /stream and /ws, so the token never ends up in a URL
+func (app *application) createStreamTicketHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUserFromCtx(r)
+
+	ticket, expiresAt, err := app.store.StreamTickets.Create(r.Context(), user.UserId, app.config.stream.ticketTTL)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.jsonResponse(w, http.StatusCreated, streamTicketResponse{Ticket: ticket, ExpiresAt: expiresAt})
+}
+
+func writeEvent(w http.ResponseWriter, event realtime.Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+	return err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+func (app *application) getSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := app.config.suggestions.limit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		parsed, err := strconv.Atoi(l)
+		if err != nil {
+			app.badRequestError(w, r, err)
+			return
+		}
+		limit = parsed
+	}
+
+	if err := Validate.Var(limit, "gte=1,lte=50"); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+
+	suggestions, err := app.store.Suggestions.GetByUserId(r.Context(), user.UserId, limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// nothing precomputed yet (new or inactive user), compute on demand
+	if len(suggestions) == 0 {
+		suggestions, err = app.store.Suggestions.Compute(r.Context(), user.UserId, limit)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, suggestions); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/shehab910/social/internal/realtime"
+	"github.com/shehab910/social/internal/store"
+)
+
+type SuspendUserPayload struct {
+	// SuspendedUntil omitted bans the user permanently
+	SuspendedUntil *time.Time `json:"suspended_until"`
+	Reason         string     `json:"reason" validate:"required,max=1000"`
+}
+
+func (app *application) suspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	var payload SuspendUserPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if payload.SuspendedUntil != nil && !payload.SuspendedUntil.After(time.Now()) {
+		app.unProcessableContent(w, r, errors.New("suspended_until must be in the future"))
+		return
+	}
+
+	user := getUserFromCtx(r)
+	moderator := app.getCurrentUserFromCtx(r)
+
+	ctx := r.Context()
+
+	// the previous suspension, if any, is the before snapshot
+	before, err := app.store.Suspensions.GetActive(ctx, user.ID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Suspensions.Suspend(ctx, moderator.UserId, user.ID, payload.SuspendedUntil, payload.Reason); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, store.ErrSuspendStaff):
+			app.customErrorResponse(w, r, http.StatusForbidden, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, auditEvent{
+		Action:     store.AuditUserSuspend,
+		ActorID:    moderator.UserId,
+		TargetType: store.AuditTargetUser,
+		TargetID:   user.ID,
+		Before:     before,
+		After:      payload,
+	})
+
+	app.endUserSessions(r, user.ID, realtime.EventSuspended)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) liftSuspensionHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromCtx(r)
+	moderator := app.getCurrentUserFromCtx(r)
+
+	before, err := app.store.Suspensions.GetActive(r.Context(), user.ID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Suspensions.Lift(r.Context(), moderator.UserId, user.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.audit(r, auditEvent{
+		Action:     store.AuditUserLiftSuspension,
+		ActorID:    moderator.UserId,
+		TargetType: store.AuditTargetUser,
+		TargetID:   user.ID,
+		Before:     before,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// endUserSessions closes the user's open streams and gateway connections with
+// an event ending the session, the other requests are rejected by AuthenticateMiddleware
+func (app *application) endUserSessions(r *http.Request, userId int64, eventType string) {
+	app.publish(r.Context(), realtime.UserTopic(userId), eventType, map[string]int64{"user_id": userId})
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shehab910/social/internal/store"
+)
+
+func (app *application) getFollowedTagsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUserFromCtx(r)
+
+	tags, err := app.store.FollowedTags.GetByUserId(r.Context(), user.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+func (app *application) followTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag := store.NormalizeTag(chi.URLParam(r, "tag"))
+	if err := Validate.Var(tag, "required,max=20"); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := app.getCurrentUserFromCtx(r)
+
+	if err := app.store.FollowedTags.Follow(r.Context(), user.UserId, tag); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			app.conflictResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) unfollowTagHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.getCurrentUserFromCtx(r)
+
+	if err := app.store.FollowedTags.Unfollow(r.Context(), user.UserId, chi.URLParam(r, "tag")); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/shehab910/social/internal/store"
+	"github.com/shehab910/social/internal/timeline"
 	"github.com/shehab910/social/internal/utils"
 )
 
@@ -38,15 +39,32 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 	followedUser := getUserFromCtx(r)
 	followerUser := app.getCurrentUserFromCtx(r)
 
+	if followedUser.ID == followerUser.UserId {
+		app.customErrorResponse(w, r, http.StatusBadRequest, ErrSelfFollow)
+		return
+	}
+
+	if followedUser.IsPrivate {
+		app.requestFollow(w, r, followerUser.UserId, followedUser.ID)
+		return
+	}
+
 	if err := app.store.Followers.Follow(r.Context(), followerUser.UserId, followedUser.ID); err != nil {
 		if errors.Is(err, store.ErrConflict) {
 			app.conflictResponse(w, r, err)
 			return
 		}
+		if errors.Is(err, store.ErrBlocked) {
+			app.customErrorResponse(w, r, http.StatusForbidden, ErrBlockedUser)
+			return
+		}
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	app.fanOut.Enqueue(timeline.Job{Kind: timeline.JobBackfill, FollowerID: followerUser.UserId, FollowedID: followedUser.ID})
+	app.notify(r.Context(), []int64{followedUser.ID}, followerUser.UserId, store.NotificationFollow, nil)
+
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -66,6 +84,14 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	// unfollowing also cancels a pending follow request
+	if err := app.store.FollowRequests.Delete(r.Context(), followerUser.UserId, followedUser.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.fanOut.Enqueue(timeline.Job{Kind: timeline.JobPrune, FollowerID: followerUser.UserId, FollowedID: followedUser.ID})
+
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -99,22 +125,27 @@ func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 func (app *application) getUserProfileHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromCtx(r)
 
-	//todo: check if user is logged in and pass current user to GetProfileById
-	// currUser, isLoggedIn := r.Context().Value(currUserCtx).(utils.TokenClaims)
-	// var currUserId *int64
-	// if !isLoggedIn {
-	// 	currUserId = nil
-	// } else {
-	// 	currUserId = &currUser.UserId
-	// }
-	// log.Info().Msgf("currUserId: %v", currUserId)
-
-	profileData, err := app.store.Users.GetProfileById(r.Context(), user.ID, nil)
+	var currUserId *int64
+	currUser, isLoggedIn := r.Context().Value(currUserCtx).(utils.TokenClaims)
+	if isLoggedIn {
+		currUserId = &currUser.UserId
+	}
+
+	profileData, err := app.store.Users.GetProfileById(r.Context(), user.ID, currUserId)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
+	if isLoggedIn && currUser.UserId != user.ID {
+		followedBy, err := app.store.Followers.GetFollowedBy(r.Context(), user.ID, currUser.UserId, 3)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		profileData.FollowedBy = &followedBy
+	}
+
 	if err := app.jsonResponse(w, http.StatusOK, profileData); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -137,10 +168,75 @@ func (app *application) isFollowedHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+func (app *application) getFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollows(w, r, app.store.Followers.GetFollowers)
+}
+
+func (app *application) getFollowingHandler(w http.ResponseWriter, r *http.Request) {
+	app.listFollows(w, r, app.store.Followers.GetFollowing)
+}
+
+type listFollowsFunc func(ctx context.Context, userId int64, viewerId int64, cq store.CursorPaginatedQuery) (store.CursorPage[store.FollowEntry], error)
+
+func (app *application) listFollows(w http.ResponseWriter, r *http.Request, list listFollowsFunc) {
+	cq := store.CursorPaginatedQuery{
+		Limit: 20,
+	}
+
+	if err := cq.Parse(r); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	viewer := app.getCurrentUserFromCtx(r)
+
+	canView, err := app.canViewUserContent(r.Context(), viewer.UserId, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !canView {
+		app.customErrorResponse(w, r, http.StatusForbidden, ErrPrivateAccount)
+		return
+	}
+
+	page, err := list(r.Context(), user.ID, viewer.UserId, cq)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCursor) {
+			app.badRequestError(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
 func (app *application) getUserPostsHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromCtx(r)
+	viewer := app.getCurrentUserFromCtx(r)
+
+	canView, err := app.canViewUserContent(r.Context(), viewer.UserId, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !canView {
+		app.customErrorResponse(w, r, http.StatusForbidden, ErrPrivateAccount)
+		return
+	}
 
-	posts, err := app.store.Posts.GetUserPostsByUserId(r.Context(), user.ID)
+	posts, err := app.store.Posts.GetUserPostsByUserId(r.Context(), user.ID, viewer.UserId)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -156,6 +252,126 @@ func (app *application) getUserPostsHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+type UpdateSettingsPayload struct {
+	IsPrivate *bool   `json:"is_private"`
+	DMPolicy  *string `json:"dm_policy" validate:"omitempty,oneof=everyone mutuals"`
+}
+
+func (app *application) updateSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateSettingsPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	claims := app.getCurrentUserFromCtx(r)
+	user, err := app.store.Users.GetById(r.Context(), claims.UserId)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	settings := store.UserSettings{
+		IsPrivate: user.IsPrivate,
+		DMPolicy:  user.DMPolicy,
+	}
+
+	isPayloadEmpty := true
+	if payload.IsPrivate != nil {
+		isPayloadEmpty = false
+		settings.IsPrivate = *payload.IsPrivate
+	}
+
+	if payload.DMPolicy != nil {
+		isPayloadEmpty = false
+		settings.DMPolicy = *payload.DMPolicy
+	}
+
+	if isPayloadEmpty {
+		app.badRequestError(w, r, ErrEmptyJSONBody)
+		return
+	}
+
+	if err := app.store.Users.UpdateSettings(r.Context(), user.ID, settings); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, settings); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// canViewUserContent reports whether the viewer (0 if anonymous) may see the
+// content of owner, private accounts are only visible to themselves and their followers
+func (app *application) canViewUserContent(ctx context.Context, viewerId int64, owner *store.User) (bool, error) {
+	if !owner.IsPrivate || owner.ID == viewerId {
+		return true, nil
+	}
+
+	if viewerId == 0 {
+		return false, nil
+	}
+
+	return app.store.Followers.IsFollowed(ctx, viewerId, owner.ID)
+}
+
+type UpdateRolePayload struct {
+	Role string `json:"role" validate:"required,oneof=user moderator admin"`
+}
+
+type roleSnapshot struct {
+	Role string `json:"role"`
+}
+
+func (app *application) updateUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	user := getUserFromCtx(r)
+	admin := app.getCurrentUserFromCtx(r)
+
+	// keeps at least the admin making the change
+	if user.ID == admin.UserId {
+		app.customErrorResponse(w, r, http.StatusForbidden, errors.New("you can't change your own role"))
+		return
+	}
+
+	if err := app.store.Users.UpdateRole(r.Context(), user.ID, payload.Role); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			app.notFoundResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.audit(r, auditEvent{
+		Action:     store.AuditRoleChange,
+		ActorID:    admin.UserId,
+		TargetType: store.AuditTargetUser,
+		TargetID:   user.ID,
+		Before:     roleSnapshot{Role: user.Role},
+		After:      roleSnapshot{Role: payload.Role},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func getUserFromCtx(r *http.Request) *store.User {
 	user, _ := r.Context().Value(userCtx).(*store.User)
 	return user
@@ -3,10 +3,17 @@ package db
 import (
 	"context"
 	"database/sql"
+	"net/url"
+	"strings"
 	"time"
 )
 
 func New(addr string, maxOpenConns int, maxIdleConns int, maxIdleTime string, schemaName string) (*sql.DB, error) {
+	addr, err := withSearchPath(addr, schemaName)
+	if err != nil {
+		return nil, err
+	}
+
 	db, err := sql.Open("postgres", addr)
 	if err != nil {
 		return nil, err
@@ -24,9 +31,29 @@ func New(addr string, maxOpenConns int, maxIdleConns int, maxIdleTime string, sc
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 
-	if _, err := db.ExecContext(ctx, "SET search_path to "+schemaName+", public"); err != nil {
+	if err := db.PingContext(ctx); err != nil {
 		return nil, err
 	}
 
 	return db, nil
 }
+
+// withSearchPath adds the search path to the connection string so every
+// connection of the pool starts with it, a SET would only reach one of them
+func withSearchPath(addr string, schemaName string) (string, error) {
+	searchPath := schemaName + ",public"
+
+	if !strings.HasPrefix(addr, "postgres://") && !strings.HasPrefix(addr, "postgresql://") {
+		return addr + " search_path=" + searchPath, nil
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("search_path", searchPath)
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
@@ -0,0 +1,381 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+//go:embed "migrations"
+var MigrationsFS embed.FS
+
+// MigrationsDir is where create writes new migrations, relative to the repo root
+const MigrationsDir = "internal/db/migrations"
+
+// migrationLockKey is the advisory lock held while migrating so concurrent
+// deploys run one after the other
+const migrationLockKey = 72_633_001
+
+var (
+	ErrUnknownVersion = errors.New("unknown migration version")
+	ErrNoMigration    = errors.New("no migration to revert")
+)
+
+// migrationFileRe matches <version>_<name>.<up|down>.sql
+var migrationFileRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version int
+	Name    string
+	// AppliedAt is nil for pending migrations
+	AppliedAt *time.Time
+}
+
+// LoadMigrations reads the migrations of dir in fsys ordered by version, each
+// version needs both its up and down file
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	// files counts the up and down files of each version, they may be empty
+	files := map[int]int{}
+	for _, entry := range entries {
+		match := migrationFileRe.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+
+		files[version]++
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if files[migration.Version] != 2 {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrator applies migrations to the schema that db.New puts first on the
+// search path, the applied versions are tracked in its schema_migrations table
+type Migrator struct {
+	db         *sql.DB
+	schema     string
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB, schema string, migrations []Migration) *Migrator {
+	return &Migrator{db: db, schema: schema, migrations: migrations}
+}
+
+// Up applies every pending migration and returns them
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if len(m.migrations) == 0 {
+		return nil, nil
+	}
+	return m.Goto(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// Down reverts the latest applied migration
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var reverted *Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			return ErrNoMigration
+		}
+
+		latest := maxVersion(applied)
+		migration, err := m.find(latest)
+		if err != nil {
+			return err
+		}
+
+		if err := revert(ctx, conn, migration); err != nil {
+			return err
+		}
+		reverted = migration
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Goto applies or reverts migrations until version is the latest applied one,
+// 0 reverts them all. It returns the migrations it ran, in the order it ran them
+func (m *Migrator) Goto(ctx context.Context, version int) ([]Migration, error) {
+	if version != 0 {
+		if _, err := m.find(version); err != nil {
+			return nil, err
+		}
+	}
+
+	ran := []Migration{}
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		// the applied versions above the target are reverted newest first
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if migration.Version <= version || !applied[migration.Version] {
+				continue
+			}
+			if err := revert(ctx, conn, &migration); err != nil {
+				return err
+			}
+			ran = append(ran, migration)
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version > version || applied[migration.Version] {
+				continue
+			}
+			if err := apply(ctx, conn, &migration); err != nil {
+				return err
+			}
+			ran = append(ran, migration)
+		}
+
+		return nil
+	})
+
+	return ran, err
+}
+
+// Force records the migrations up to version as applied and the later ones as
+// pending without running any of them, it adopts a db whose schema was
+// created by hand or repairs the bookkeeping after a failed manual fix. 0
+// marks them all pending
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	if version != 0 {
+		if _, err := m.find(version); err != nil {
+			return err
+		}
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version > $1`, version); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			query := `
+				INSERT INTO schema_migrations (version, name) VALUES ($1, $2)
+				ON CONFLICT (version) DO NOTHING
+			`
+			if _, err := tx.ExecContext(ctx, query, migration.Version, migration.Name); err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	})
+}
+
+// Status lists the known migrations with when they were applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		rows, err := conn.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		appliedAt := map[int]time.Time{}
+		for rows.Next() {
+			var version int
+			var at time.Time
+			if err := rows.Scan(&version, &at); err != nil {
+				return err
+			}
+			appliedAt[version] = at
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+			if at, ok := appliedAt[migration.Version]; ok {
+				status.AppliedAt = &at
+			}
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+func (m *Migrator) find(version int) (*Migration, error) {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+}
+
+// withLock runs fn on a single connection holding the migration lock, with
+// the schema and schema_migrations created if needed
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+
+	// the SET below is session-level, the connection must not go back to the
+	// pool with it. RESET restores the search path of the connection string
+	defer conn.ExecContext(context.WithoutCancel(ctx), `RESET search_path`)
+
+	schema := pq.QuoteIdentifier(m.schema)
+	setup := []string{
+		`CREATE SCHEMA IF NOT EXISTS ` + schema,
+		// the search path of the connection string skips schemas that didn't exist yet
+		`SET search_path TO ` + schema + `, public`,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint NOT NULL,
+			name text NOT NULL,
+			applied_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (version)
+		)`,
+	}
+	for _, query := range setup {
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+func maxVersion(versions map[int]bool) int {
+	latest := 0
+	for version := range versions {
+		latest = max(latest, version)
+	}
+	return latest
+}
+
+// apply and revert run the migration and its bookkeeping in one transaction,
+// a failing migration leaves nothing behind
+func apply(ctx context.Context, conn *sql.Conn, migration *Migration) error {
+	err := inTx(ctx, conn, migration.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name)
+	if err != nil {
+		return fmt.Errorf("applying %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+func revert(ctx context.Context, conn *sql.Conn, migration *Migration) error {
+	err := inTx(ctx, conn, migration.Down, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+	if err != nil {
+		return fmt.Errorf("reverting %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	return nil
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, script string, bookkeeping string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS followers;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS users;
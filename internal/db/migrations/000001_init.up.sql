@@ -1,3 +1,30 @@
+CREATE TABLE users (
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
+    username character varying(255) NOT NULL,
+    password character varying(255) NOT NULL,
+    email character varying(255) NOT NULL,
+    bio character varying(255),
+    image_url character varying(255),
+    role character varying(255) DEFAULT 'user' NOT NULL,
+    last_login_at timestamp(0) with time zone DEFAULT NULL,
+    verified boolean DEFAULT false,
+    created_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE posts (
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
+    user_id bigint NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    tags text[],
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
 CREATE TABLE comments (
     id bigint NOT NULL,
     post_id bigint NOT NULL,
@@ -18,30 +45,3 @@ CREATE TABLE followers (
     FOREIGN KEY (follower_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE,
     FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
 );
-
-CREATE TABLE posts (
-    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
-    user_id bigint NOT NULL,
-    title text NOT NULL,
-    content text NOT NULL,
-    tags text[],
-    created_at timestamp with time zone DEFAULT now() NOT NULL,
-    updated_at timestamp with time zone DEFAULT now() NOT NULL,
-    PRIMARY KEY (id),
-    FOREIGN KEY (user_id) REFERENCES users(id)
-);
-
-CREATE TABLE users (
-    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
-    username character varying(255) NOT NULL,
-    password character varying(255) NOT NULL,
-    email character varying(255) NOT NULL,
-    bio character varying(255),
-    image_url character varying(255),
-    role character varying(255) DEFAULT 'user' NOT NULL,
-    last_login_at timestamp(0) with time zone DEFAULT NULL,
-    verified boolean DEFAULT false,
-    created_at timestamp(0) with time zone DEFAULT now() NOT NULL,
-    updated_at timestamp(0) with time zone DEFAULT now() NOT NULL,
-    PRIMARY KEY (id)
-);
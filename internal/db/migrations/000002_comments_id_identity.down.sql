@@ -0,0 +1 @@
+ALTER TABLE comments ALTER COLUMN id DROP IDENTITY IF EXISTS;
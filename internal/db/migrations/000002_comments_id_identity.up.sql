@@ -0,0 +1,4 @@
+-- comments.id had no default, new ids continue after the existing ones
+ALTER TABLE comments ALTER COLUMN id ADD GENERATED ALWAYS AS IDENTITY;
+
+SELECT setval(pg_get_serial_sequence('comments', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM comments;
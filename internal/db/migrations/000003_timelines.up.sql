@@ -0,0 +1,13 @@
+CREATE TABLE timelines (
+    user_id bigint NOT NULL,
+    post_id bigint NOT NULL,
+    author_id bigint NOT NULL,
+    created_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (user_id, post_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX timelines_user_id_created_at_idx ON timelines (user_id, created_at DESC);
+CREATE INDEX timelines_user_id_author_id_idx ON timelines (user_id, author_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS muted_users;
+DROP TABLE IF EXISTS muted_terms;
+DROP TABLE IF EXISTS followed_tags;
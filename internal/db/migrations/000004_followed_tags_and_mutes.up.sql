@@ -0,0 +1,25 @@
+CREATE TABLE followed_tags (
+    user_id bigint NOT NULL,
+    tag text NOT NULL,
+    created_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (user_id, tag),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE muted_terms (
+    user_id bigint NOT NULL,
+    kind character varying(16) NOT NULL CHECK (kind IN ('word', 'tag')),
+    term text NOT NULL,
+    created_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (user_id, kind, term),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE muted_users (
+    user_id bigint NOT NULL,
+    muted_user_id bigint NOT NULL,
+    created_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (user_id, muted_user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (muted_user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
@@ -0,0 +1,10 @@
+CREATE TABLE blocks (
+    user_id bigint NOT NULL,
+    blocked_user_id bigint NOT NULL,
+    created_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (user_id, blocked_user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (blocked_user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX blocks_blocked_user_id_idx ON blocks (blocked_user_id);
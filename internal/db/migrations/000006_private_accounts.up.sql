@@ -0,0 +1,10 @@
+ALTER TABLE users ADD COLUMN is_private boolean DEFAULT false NOT NULL;
+
+CREATE TABLE follow_requests (
+    user_id bigint NOT NULL,
+    requester_id bigint NOT NULL,
+    created_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (user_id, requester_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (requester_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
@@ -0,0 +1,15 @@
+CREATE TABLE follow_suggestions (
+    user_id bigint NOT NULL,
+    suggested_user_id bigint NOT NULL,
+    score double precision NOT NULL,
+    mutual_count integer DEFAULT 0 NOT NULL,
+    mutual_usernames text[] DEFAULT '{}' NOT NULL,
+    shared_tags_count integer DEFAULT 0 NOT NULL,
+    co_engagement_count integer DEFAULT 0 NOT NULL,
+    computed_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (user_id, suggested_user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (suggested_user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX follow_suggestions_user_id_score_idx ON follow_suggestions (user_id, score DESC);
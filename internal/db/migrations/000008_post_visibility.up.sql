@@ -0,0 +1 @@
+ALTER TABLE posts ADD COLUMN visibility character varying(16) DEFAULT 'public' NOT NULL CHECK (visibility IN ('public', 'followers', 'unlisted', 'private'));
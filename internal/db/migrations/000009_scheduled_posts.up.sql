@@ -0,0 +1,5 @@
+ALTER TABLE posts
+    ADD COLUMN status character varying(16) DEFAULT 'published' NOT NULL CHECK (status IN ('draft', 'scheduled', 'published')),
+    ADD COLUMN publish_at timestamp with time zone;
+
+CREATE INDEX posts_scheduled_publish_at_idx ON posts (publish_at) WHERE status = 'scheduled';
@@ -0,0 +1,14 @@
+ALTER TABLE posts ADD COLUMN edited_at timestamp with time zone;
+
+CREATE TABLE post_revisions (
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
+    post_id bigint NOT NULL,
+    revision integer NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    tags text[],
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE (post_id, revision),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS mentions;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS entities;
+ALTER TABLE posts DROP COLUMN IF EXISTS entities;
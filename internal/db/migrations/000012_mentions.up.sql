@@ -0,0 +1,20 @@
+ALTER TABLE posts ADD COLUMN entities jsonb DEFAULT '[]' NOT NULL;
+ALTER TABLE comments ADD COLUMN entities jsonb DEFAULT '[]' NOT NULL;
+
+CREATE TABLE mentions (
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
+    post_id bigint NOT NULL,
+    comment_id bigint,
+    author_id bigint NOT NULL,
+    mentioned_user_id bigint NOT NULL,
+    created_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (mentioned_user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX mentions_post_id_mentioned_user_id_idx ON mentions (post_id, mentioned_user_id) WHERE comment_id IS NULL;
+CREATE UNIQUE INDEX mentions_comment_id_mentioned_user_id_idx ON mentions (comment_id, mentioned_user_id) WHERE comment_id IS NOT NULL;
+CREATE INDEX mentions_mentioned_user_id_created_at_idx ON mentions (mentioned_user_id, created_at DESC);
@@ -0,0 +1,18 @@
+CREATE TABLE notifications (
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
+    user_id bigint NOT NULL,
+    type varchar(20) NOT NULL,
+    post_id bigint,
+    -- actor_ids holds the distinct actors of the group, latest first
+    actor_ids bigint[] NOT NULL,
+    read_at timestamp(0) with time zone,
+    created_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+-- new activity joins the unread group of the same type and post
+CREATE UNIQUE INDEX notifications_unread_group_idx ON notifications (user_id, type, (COALESCE(post_id, 0))) WHERE read_at IS NULL;
+CREATE INDEX notifications_user_id_updated_at_idx ON notifications (user_id, updated_at DESC, id DESC);
@@ -0,0 +1,39 @@
+ALTER TABLE users ADD COLUMN dm_policy varchar(20) DEFAULT 'everyone' NOT NULL;
+
+CREATE TABLE conversations (
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
+    created_by bigint,
+    is_group boolean DEFAULT false NOT NULL,
+    title varchar(100),
+    -- direct_key is "<lowest user id>:<highest user id>" for one-to-one conversations
+    direct_key varchar(50) UNIQUE,
+    created_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    updated_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (created_by) REFERENCES users(id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE TABLE conversation_members (
+    conversation_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    last_read_message_id bigint DEFAULT 0 NOT NULL,
+    joined_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (conversation_id, user_id),
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX conversation_members_user_id_idx ON conversation_members (user_id);
+
+CREATE TABLE messages (
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
+    conversation_id bigint NOT NULL,
+    sender_id bigint NOT NULL,
+    content text NOT NULL,
+    created_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (sender_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX messages_conversation_id_created_at_idx ON messages (conversation_id, created_at DESC, id DESC);
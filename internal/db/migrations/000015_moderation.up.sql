@@ -0,0 +1,59 @@
+-- hidden_at is set by moderation, either by enough reports or by a moderator
+ALTER TABLE posts ADD COLUMN hidden_at timestamp with time zone;
+ALTER TABLE comments ADD COLUMN hidden_at timestamp(0) with time zone;
+
+ALTER TABLE users
+    ADD COLUMN suspended_until timestamp(0) with time zone,
+    ADD COLUMN suspension_reason text;
+
+CREATE TABLE reports (
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
+    reporter_id bigint NOT NULL,
+    target_type varchar(20) NOT NULL CHECK (target_type IN ('post', 'comment', 'user')),
+    target_id bigint NOT NULL,
+    reason varchar(30) NOT NULL,
+    details text,
+    status varchar(20) DEFAULT 'open' NOT NULL CHECK (status IN ('open', 'claimed', 'resolved', 'dismissed')),
+    claimed_by bigint,
+    claimed_at timestamp(0) with time zone,
+    resolved_by bigint,
+    resolved_at timestamp(0) with time zone,
+    resolution varchar(30),
+    created_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE (reporter_id, target_type, target_id),
+    FOREIGN KEY (reporter_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (claimed_by) REFERENCES users(id) ON UPDATE CASCADE ON DELETE SET NULL,
+    FOREIGN KEY (resolved_by) REFERENCES users(id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE INDEX reports_status_created_at_idx ON reports (status, created_at DESC, id DESC);
+CREATE INDEX reports_target_idx ON reports (target_type, target_id);
+
+CREATE TABLE moderation_actions (
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
+    moderator_id bigint,
+    report_id bigint,
+    action varchar(30) NOT NULL,
+    target_type varchar(20) NOT NULL,
+    target_id bigint NOT NULL,
+    target_user_id bigint,
+    note text,
+    created_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (moderator_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE SET NULL,
+    FOREIGN KEY (report_id) REFERENCES reports(id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE INDEX moderation_actions_created_at_idx ON moderation_actions (created_at DESC, id DESC);
+
+CREATE TABLE user_warnings (
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
+    user_id bigint NOT NULL,
+    report_id bigint,
+    note text,
+    created_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (report_id) REFERENCES reports(id) ON UPDATE CASCADE ON DELETE SET NULL
+);
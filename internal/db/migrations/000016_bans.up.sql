@@ -0,0 +1,2 @@
+-- a suspension lasts until suspended_until, banned_at makes it permanent
+ALTER TABLE users ADD COLUMN banned_at timestamp(0) with time zone;
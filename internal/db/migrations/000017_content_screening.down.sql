@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS screening_rules;
+
+DELETE FROM reports WHERE reporter_id IS NULL;
+ALTER TABLE reports ALTER COLUMN reporter_id SET NOT NULL;
@@ -0,0 +1,16 @@
+-- reporter_id is NULL for the reports filed by the screening pipeline
+ALTER TABLE reports ALTER COLUMN reporter_id DROP NOT NULL;
+
+CREATE TABLE screening_rules (
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
+    -- word and regex rules match the text, domain rules match the linked hosts
+    kind varchar(20) NOT NULL CHECK (kind IN ('word', 'regex', 'domain')),
+    pattern text NOT NULL,
+    action varchar(20) NOT NULL CHECK (action IN ('flag', 'reject')),
+    reason varchar(255),
+    created_by bigint,
+    created_at timestamp(0) with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE (kind, pattern),
+    FOREIGN KEY (created_by) REFERENCES users(id) ON UPDATE CASCADE ON DELETE SET NULL
+);
@@ -0,0 +1,15 @@
+CREATE TABLE data_exports (
+    id bigint NOT NULL GENERATED ALWAYS AS IDENTITY,
+    user_id bigint NOT NULL,
+    status varchar(20) DEFAULT 'pending' NOT NULL CHECK (status IN ('pending', 'ready', 'failed', 'expired')),
+    file_path text,
+    error text,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    completed_at timestamp with time zone,
+    expires_at timestamp with time zone,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+-- only one export per user is built at a time
+CREATE UNIQUE INDEX data_exports_pending_user_id_idx ON data_exports (user_id) WHERE status = 'pending';
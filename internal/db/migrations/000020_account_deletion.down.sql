@@ -0,0 +1,5 @@
+ALTER TABLE posts
+    DROP CONSTRAINT posts_user_id_fkey,
+    ADD CONSTRAINT posts_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id);
+
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_requested_at;
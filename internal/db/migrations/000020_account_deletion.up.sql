@@ -0,0 +1,7 @@
+-- set by the user, the account is purged once the grace period is over
+ALTER TABLE users ADD COLUMN deletion_requested_at timestamp(0) with time zone;
+
+-- purging an account takes its posts along
+ALTER TABLE posts
+    DROP CONSTRAINT posts_user_id_fkey,
+    ADD CONSTRAINT posts_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS posts_user_id_created_at_idx;
+DROP TRIGGER IF EXISTS followers_follower_count ON followers;
+DROP FUNCTION IF EXISTS followers_update_follower_count();
+
+ALTER TABLE users DROP COLUMN IF EXISTS follower_count;
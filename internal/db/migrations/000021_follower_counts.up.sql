@@ -0,0 +1,25 @@
+-- follower_count tells celebrity authors apart without counting their
+-- followers, the trigger keeps it in sync with followers
+ALTER TABLE users ADD COLUMN follower_count integer DEFAULT 0 NOT NULL;
+
+UPDATE users u
+SET follower_count = f.count
+FROM (SELECT user_id, COUNT(*) AS count FROM followers GROUP BY user_id) f
+WHERE f.user_id = u.id;
+
+CREATE FUNCTION followers_update_follower_count() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE users SET follower_count = follower_count + 1 WHERE id = NEW.user_id;
+    ELSE
+        UPDATE users SET follower_count = follower_count - 1 WHERE id = OLD.user_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER followers_follower_count AFTER INSERT OR DELETE ON followers
+    FOR EACH ROW EXECUTE FUNCTION followers_update_follower_count();
+
+-- the posts of followed celebrities are read by author, newest first
+CREATE INDEX posts_user_id_created_at_idx ON posts (user_id, created_at DESC, id DESC);
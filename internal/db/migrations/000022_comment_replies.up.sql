@@ -0,0 +1,2 @@
+-- parent_comment_id is the comment a reply answers, replies stay when it's deleted
+ALTER TABLE comments ADD COLUMN parent_comment_id bigint REFERENCES comments(id) ON UPDATE CASCADE ON DELETE SET NULL;
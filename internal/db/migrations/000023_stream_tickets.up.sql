@@ -0,0 +1,11 @@
+-- stream tickets authenticate EventSource and WebSocket connections, only
+-- their hash is stored and each is used once
+CREATE TABLE stream_tickets (
+    ticket_hash bytea NOT NULL,
+    user_id bigint NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (ticket_hash),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX stream_tickets_expires_at_idx ON stream_tickets (expires_at);
@@ -0,0 +1,2 @@
+ALTER TABLE comments DROP COLUMN IF EXISTS hidden_reason;
+ALTER TABLE posts DROP COLUMN IF EXISTS hidden_reason;
@@ -0,0 +1,18 @@
+-- hidden_reason tells the auto-hidden content (reports) from the removed one
+-- (moderator), dismissing reports only brings back the former
+ALTER TABLE posts ADD COLUMN hidden_reason text CHECK (hidden_reason IN ('reports', 'moderator'));
+ALTER TABLE comments ADD COLUMN hidden_reason text CHECK (hidden_reason IN ('reports', 'moderator'));
+
+UPDATE posts p
+SET hidden_reason = CASE WHEN EXISTS (
+	SELECT 1 FROM moderation_actions ma
+	WHERE ma.target_type = 'post' AND ma.target_id = p.id AND ma.action = 'remove_content'
+) THEN 'moderator' ELSE 'reports' END
+WHERE hidden_at IS NOT NULL;
+
+UPDATE comments c
+SET hidden_reason = CASE WHEN EXISTS (
+	SELECT 1 FROM moderation_actions ma
+	WHERE ma.target_type = 'comment' AND ma.target_id = c.id AND ma.action = 'remove_content'
+) THEN 'moderator' ELSE 'reports' END
+WHERE hidden_at IS NOT NULL;
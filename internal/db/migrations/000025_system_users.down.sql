@@ -0,0 +1,3 @@
+-- the placeholder account is kept, purged accounts' content still points to it
+DROP INDEX IF EXISTS users_is_system_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS is_system;
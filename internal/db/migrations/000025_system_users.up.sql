@@ -0,0 +1,13 @@
+-- is_system marks the placeholder account the anonymized content of purged
+-- accounts is moved to, it's created here instead of looked up by email
+ALTER TABLE users ADD COLUMN is_system boolean DEFAULT false NOT NULL;
+CREATE UNIQUE INDEX users_is_system_idx ON users (is_system) WHERE is_system;
+
+-- adopt the placeholder created by earlier purges, it's the only account
+-- without a password hash
+UPDATE users SET is_system = true
+WHERE id = (SELECT min(id) FROM users WHERE email = 'deleted@users.invalid' AND password = '');
+
+INSERT INTO users (username, password, email, verified, is_system)
+SELECT 'deleted', '', 'deleted@users.invalid', false, true
+WHERE NOT EXISTS (SELECT 1 FROM users WHERE is_system);
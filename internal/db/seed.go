@@ -2,7 +2,6 @@ package db
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 
 	"math/rand"
@@ -74,25 +73,26 @@ var comments = []string{
 	"Thanks for the information, very useful.",
 }
 
-func Seed(store *store.Storage, db *sql.DB) {
+func Seed(storage *store.Storage) {
 	ctx := context.Background()
 
 	users := generateUsers(10)
-	tx, _ := db.BeginTx(ctx, nil)
-
-	for _, user := range users {
-		if err := store.Users.Create(ctx, user); err != nil {
-			_ = tx.Rollback()
-			log.Err(err).Msg("Error creating user")
-			return
+	err := storage.WithTx(ctx, func(tx *store.Storage) error {
+		for _, user := range users {
+			if err := tx.Users.Create(ctx, user); err != nil {
+				return err
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		log.Err(err).Msg("Error creating users")
+		return
 	}
 
-	tx.Commit()
-
 	posts := generatePosts(20, users)
 	for _, post := range posts {
-		if err := store.Posts.Create(ctx, post); err != nil {
+		if err := storage.Posts.Create(ctx, post); err != nil {
 			log.Err(err).Msg("Error creating post")
 			return
 		}
@@ -100,7 +100,7 @@ func Seed(store *store.Storage, db *sql.DB) {
 
 	comments := generateComments(50, users, posts)
 	for _, comment := range comments {
-		if err := store.Comments.Create(ctx, comment); err != nil {
+		if err := storage.Comments.Create(ctx, comment); err != nil {
 			log.Err(err).Msg("Error creating comment")
 			return
 		}
@@ -0,0 +1,78 @@
+package diff
+
+import "strings"
+
+type OpType string
+
+const (
+	OpEqual  OpType = "equal"
+	OpInsert OpType = "insert"
+	OpDelete OpType = "delete"
+)
+
+type Op struct {
+	Type OpType `json:"type"`
+	Text string `json:"text"`
+}
+
+// Words computes a word level diff turning a into b, consecutive words of the
+// same operation are merged into a single Op
+func Words(a string, b string) []Op {
+	return merge(lcsDiff(strings.Fields(a), strings.Fields(b)))
+}
+
+// lcsDiff diffs two token lists using their longest common subsequence
+func lcsDiff(a []string, b []string) []Op {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]Op, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, Op{Type: OpEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, Op{Type: OpDelete, Text: a[i]})
+			i++
+		default:
+			ops = append(ops, Op{Type: OpInsert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, Op{Type: OpDelete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, Op{Type: OpInsert, Text: b[j]})
+	}
+
+	return ops
+}
+
+func merge(ops []Op) []Op {
+	merged := []Op{}
+	for _, op := range ops {
+		last := len(merged) - 1
+		if last >= 0 && merged[last].Type == op.Type {
+			merged[last].Text += " " + op.Text
+			continue
+		}
+		merged = append(merged, op)
+	}
+	return merged
+}
@@ -0,0 +1,100 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want []Op
+	}{
+		{
+			name: "empty input",
+			a:    "",
+			b:    "",
+			want: []Op{},
+		},
+		{
+			name: "whitespace only input",
+			a:    "  \n",
+			b:    "\t",
+			want: []Op{},
+		},
+		{
+			name: "identical input",
+			a:    "the quick brown fox",
+			b:    "the quick brown fox",
+			want: []Op{{Type: OpEqual, Text: "the quick brown fox"}},
+		},
+		{
+			name: "identical words with other whitespace",
+			a:    "the  quick\nfox",
+			b:    "the quick fox",
+			want: []Op{{Type: OpEqual, Text: "the quick fox"}},
+		},
+		{
+			name: "pure insert into empty",
+			a:    "",
+			b:    "hello world",
+			want: []Op{{Type: OpInsert, Text: "hello world"}},
+		},
+		{
+			name: "pure insert in the middle",
+			a:    "the fox",
+			b:    "the quick brown fox",
+			want: []Op{
+				{Type: OpEqual, Text: "the"},
+				{Type: OpInsert, Text: "quick brown"},
+				{Type: OpEqual, Text: "fox"},
+			},
+		},
+		{
+			name: "pure delete to empty",
+			a:    "hello world",
+			b:    "",
+			want: []Op{{Type: OpDelete, Text: "hello world"}},
+		},
+		{
+			name: "pure delete at the end",
+			a:    "the quick brown fox",
+			b:    "the quick",
+			want: []Op{
+				{Type: OpEqual, Text: "the quick"},
+				{Type: OpDelete, Text: "brown fox"},
+			},
+		},
+		{
+			name: "replace a word",
+			a:    "the quick brown fox",
+			b:    "the slow brown fox",
+			want: []Op{
+				{Type: OpEqual, Text: "the"},
+				{Type: OpDelete, Text: "quick"},
+				{Type: OpInsert, Text: "slow"},
+				{Type: OpEqual, Text: "brown fox"},
+			},
+		},
+		{
+			name: "replace everything",
+			a:    "old title",
+			b:    "new heading",
+			want: []Op{
+				{Type: OpDelete, Text: "old title"},
+				{Type: OpInsert, Text: "new heading"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Words(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Words(%q, %q) = %+v, want %+v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package entities
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+type Type string
+
+const (
+	TypeMention Type = "mention"
+	TypeHashtag Type = "hashtag"
+)
+
+// Entity is a linkable range of a text, Start and End are UTF-16 code unit
+// offsets (End excluded) so web clients can slice the text directly
+type Entity struct {
+	Type  Type   `json:"type"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Value string `json:"value"`
+	// UserID is the resolved mentioned user, only set for mentions
+	UserID int64 `json:"user_id,omitempty"`
+}
+
+var (
+	// usernames are alphanumeric, 3 to 10 characters long (see RegisterUserPayload)
+	mentionRegex = regexp.MustCompile(`(?:^|[^\w@])@([A-Za-z0-9]{3,10})\b`)
+	hashtagRegex = regexp.MustCompile(`(?:^|[^\w#])#(\w{1,20})\b`)
+)
+
+// Parse extracts the mentions and hashtags of text ordered by their offset,
+// mentions are not resolved
+func Parse(text string) List {
+	list := List{}
+	list = append(list, find(text, mentionRegex, TypeMention)...)
+	list = append(list, find(text, hashtagRegex, TypeHashtag)...)
+
+	// both kinds never overlap, a simple insertion sort keeps them ordered
+	for i := 1; i < len(list); i++ {
+		for j := i; j > 0 && list[j].Start < list[j-1].Start; j-- {
+			list[j], list[j-1] = list[j-1], list[j]
+		}
+	}
+
+	return list
+}
+
+func find(text string, re *regexp.Regexp, kind Type) []Entity {
+	found := []Entity{}
+	for _, m := range re.FindAllStringSubmatchIndex(text, -1) {
+		// m[2]:m[3] is the name, the sigil is the byte right before it
+		start, end := m[2]-1, m[3]
+		found = append(found, Entity{
+			Type:  kind,
+			Start: utf16Len(text[:start]),
+			End:   utf16Len(text[:end]),
+			Value: text[m[2]:m[3]],
+		})
+	}
+	return found
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+type List []Entity
+
+// Usernames returns the distinct lowercased usernames mentioned in the list
+func (l List) Usernames() []string {
+	seen := map[string]bool{}
+	usernames := []string{}
+	for _, e := range l {
+		name := strings.ToLower(e.Value)
+		if e.Type == TypeMention && !seen[name] {
+			seen[name] = true
+			usernames = append(usernames, name)
+		}
+	}
+	return usernames
+}
+
+// Resolve sets the user id of the mentions found in userIds (keyed by
+// lowercased username) and drops the ones that don't match any user
+func (l List) Resolve(userIds map[string]int64) List {
+	resolved := List{}
+	for _, e := range l {
+		if e.Type == TypeMention {
+			id, ok := userIds[strings.ToLower(e.Value)]
+			if !ok {
+				continue
+			}
+			e.UserID = id
+		}
+		resolved = append(resolved, e)
+	}
+	return resolved
+}
+
+// MentionedUserIds returns the distinct resolved mentioned user ids
+func (l List) MentionedUserIds() []int64 {
+	seen := map[int64]bool{}
+	ids := []int64{}
+	for _, e := range l {
+		if e.Type == TypeMention && e.UserID != 0 && !seen[e.UserID] {
+			seen[e.UserID] = true
+			ids = append(ids, e.UserID)
+		}
+	}
+	return ids
+}
+
+func (l List) Value() (driver.Value, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(l)
+}
+
+func (l *List) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*l = List{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	default:
+		return errors.New("entities: unsupported scan type")
+	}
+}
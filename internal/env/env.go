@@ -49,3 +49,15 @@ func GetBool(key string, defaultVal bool) bool {
 	}
 	return boolVal
 }
+
+func GetFloat(key string, defaultVal float64) float64 {
+	val, ok := os.LookupEnv(key)
+	if !ok {
+		return defaultVal
+	}
+	floatVal, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return defaultVal
+	}
+	return floatVal
+}
@@ -0,0 +1,62 @@
+package export
+
+import (
+	"archive/zip"
+	"embed"
+	"encoding/json"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/shehab910/social/internal/store"
+)
+
+//go:embed "templates"
+var FS embed.FS
+
+var indexTemplate = template.Must(template.ParseFS(FS, "templates/index.html"))
+
+type indexData struct {
+	Archive     *store.UserArchive
+	GeneratedAt time.Time
+}
+
+// WriteArchive writes the zip of the user's data, one json file per section
+// and an index.html to read it in a browser
+func WriteArchive(w io.Writer, archive *store.UserArchive) error {
+	zw := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", archive.Profile},
+		{"posts.json", archive.Posts},
+		{"comments.json", archive.Comments},
+		{"followers.json", archive.Followers},
+		{"following.json", archive.Following},
+		{"media.json", archive.Media},
+	}
+
+	for _, file := range files {
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.data); err != nil {
+			return err
+		}
+	}
+
+	f, err := zw.Create("index.html")
+	if err != nil {
+		return err
+	}
+	if err := indexTemplate.Execute(f, indexData{Archive: archive, GeneratedAt: time.Now().UTC()}); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
@@ -0,0 +1,25 @@
+package export
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// Sign returns the signature of a download link of the export valid until expiresAt
+func Sign(secret string, exportId int64, expiresAt time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("export:" + strconv.FormatInt(exportId, 10) + ":" + strconv.FormatInt(expiresAt.Unix(), 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and that the link hasn't expired
+func Verify(secret string, exportId int64, expiresAt time.Time, signature string) bool {
+	if !time.Now().Before(expiresAt) {
+		return false
+	}
+	expected := Sign(secret, exportId, expiresAt)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -5,6 +5,8 @@ import "embed"
 const (
 	VerifyUserEmailTemplate = "verify_user.tmpl"
 	WelcomeEmailTemplate    = "welcome.tmpl"
+	MentionEmailTemplate    = "mention.tmpl"
+	DataExportEmailTemplate = "data_export.tmpl"
 )
 
 type VerifyUserEmailTemplateData struct {
@@ -21,6 +23,24 @@ type WelcomeEmailTemplateData struct {
 	SupportEmail string
 }
 
+type MentionEmailTemplateData struct {
+	Username     string
+	Email        string
+	MentionedBy  string
+	Source       string // "post" or "comment"
+	Excerpt      string
+	PostLink     string
+	SupportEmail string
+}
+
+type DataExportEmailTemplateData struct {
+	Username     string
+	Email        string
+	DownloadLink string
+	ExpiresAt    string
+	SupportEmail string
+}
+
 //--//
 
 //go:embed "templates"
@@ -30,6 +50,8 @@ type Client interface {
 	Send(templateFile string, username string, email string, data any) error
 	SendVerificationEmail(data VerifyUserEmailTemplateData) error
 	SendWelcomeEmail(data WelcomeEmailTemplateData) error
+	SendMentionEmail(data MentionEmailTemplateData) error
+	SendDataExportEmail(data DataExportEmailTemplateData) error
 }
 
 type EmailConfig struct {
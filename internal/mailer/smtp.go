@@ -43,6 +43,14 @@ func (m *SmtpMailer) SendWelcomeEmail(data WelcomeEmailTemplateData) error {
 	return m.Send(WelcomeEmailTemplate, data.Username, data.Email, data)
 }
 
+func (m *SmtpMailer) SendMentionEmail(data MentionEmailTemplateData) error {
+	return m.Send(MentionEmailTemplate, data.Username, data.Email, data)
+}
+
+func (m *SmtpMailer) SendDataExportEmail(data DataExportEmailTemplateData) error {
+	return m.Send(DataExportEmailTemplate, data.Username, data.Email, data)
+}
+
 func sendSingleEmail(to []string, subject string, body string, cfg EmailConfig) error {
 	auth := smtp.PlainAuth(
 		"",
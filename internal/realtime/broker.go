@@ -0,0 +1,42 @@
+package realtime
+
+import "context"
+
+// Broker carries the published events to every API replica, each replica's
+// hub then delivers them to its own subscribers
+type Broker interface {
+	Publish(ctx context.Context, event Event) error
+	// Run calls deliver for every event published through the broker, from
+	// any replica, until ctx is done
+	Run(ctx context.Context, deliver func(Event)) error
+}
+
+// MemoryBroker only reaches the subscribers of the current process, it's
+// enough for a single replica
+type MemoryBroker struct {
+	events chan Event
+}
+
+func NewMemoryBroker(bufferSize int) *MemoryBroker {
+	return &MemoryBroker{events: make(chan Event, bufferSize)}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, event Event) error {
+	select {
+	case b.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *MemoryBroker) Run(ctx context.Context, deliver func(Event)) error {
+	for {
+		select {
+		case event := <-b.events:
+			deliver(event)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package realtime
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	EventFeedPost     = "feed.post"
+	EventNotification = "notification"
+	EventComment      = "comment"
+	EventTyping       = "typing"
+	EventMessage      = "message"
+	EventMessageRead  = "message.read"
+	EventWarning      = "moderation.warning"
+	// EventSuspended and EventDeletionRequested end the user's open streams
+	// and gateway connections, see EndsSession
+	EventSuspended         = "account.suspended"
+	EventDeletionRequested = "account.deletion_requested"
+)
+
+// EndsSession reports whether the event closes the connection it's delivered on
+func EndsSession(eventType string) bool {
+	return eventType == EventSuspended || eventType == EventDeletionRequested
+}
+
+type Event struct {
+	// ID orders the events for Last-Event-ID resumes, it's a unix nano
+	// timestamp so ids from different replicas stay comparable
+	ID    int64           `json:"id"`
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+	// Ephemeral events aren't kept for resumes
+	Ephemeral bool `json:"ephemeral,omitempty"`
+	// ActorID is the user whose action produced the event, subscribers
+	// skip the events of users blocking them or blocked by them. It's 0
+	// for the events of the system
+	ActorID int64 `json:"actor_id,omitempty"`
+}
+
+func UserTopic(userId int64) string {
+	return "user:" + strconv.FormatInt(userId, 10)
+}
+
+func AuthorTopic(userId int64) string {
+	return "author:" + strconv.FormatInt(userId, 10)
+}
+
+func PostTopic(postId int64) string {
+	return "post:" + strconv.FormatInt(postId, 10)
+}
+
+// PostIdFromTopic returns the post id of a topic made by PostTopic
+func PostIdFromTopic(topic string) (int64, bool) {
+	id, found := strings.CutPrefix(topic, "post:")
+	if !found {
+		return 0, false
+	}
+	postId, err := strconv.ParseInt(id, 10, 64)
+	return postId, err == nil
+}
+
+var lastEventID atomic.Int64
+
+// nextEventID returns the current unix nano time, bumped if needed so the ids
+// generated by this process are strictly increasing
+func nextEventID() int64 {
+	for {
+		now := time.Now().UnixNano()
+		last := lastEventID.Load()
+		if now <= last {
+			now = last + 1
+		}
+		if lastEventID.CompareAndSwap(last, now) {
+			return now
+		}
+	}
+}
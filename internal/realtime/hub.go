@@ -0,0 +1,229 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+type Config struct {
+	// Broker is either "memory" or "postgres"
+	Broker string
+	// BufferSize is the number of pending events per subscriber, slow
+	// subscribers are disconnected once it's full
+	BufferSize int
+	// HistorySize is the number of recent events kept for Last-Event-ID resumes
+	HistorySize int
+}
+
+type Subscriber struct {
+	topics map[string]bool
+	events chan Event
+	closed bool
+}
+
+// Events is closed when the subscriber falls behind, it should reconnect
+// with the last received event id
+func (s *Subscriber) Events() <-chan Event {
+	return s.events
+}
+
+type Hub struct {
+	broker Broker
+	cfg    Config
+
+	mu      sync.Mutex
+	topics  map[string]map[*Subscriber]bool
+	history []Event
+	next    int
+	closed  bool
+}
+
+func NewHub(broker Broker, cfg Config) *Hub {
+	return &Hub{
+		broker: broker,
+		cfg:    cfg,
+		topics: map[string]map[*Subscriber]bool{},
+	}
+}
+
+// Run delivers the broker events to the subscribers until ctx is done
+func (h *Hub) Run(ctx context.Context) error {
+	return h.broker.Run(ctx, h.dispatch)
+}
+
+// Publish sends data to the subscribers of topic on every replica
+func (h *Hub) Publish(ctx context.Context, topic string, eventType string, data any) error {
+	return h.publish(ctx, topic, eventType, 0, data, false)
+}
+
+// PublishFrom is Publish for the events produced by actorId, see Event.ActorID
+func (h *Hub) PublishFrom(ctx context.Context, topic string, eventType string, actorId int64, data any) error {
+	return h.publish(ctx, topic, eventType, actorId, data, false)
+}
+
+// PublishEphemeral is PublishFrom for events only relevant to the currently
+// connected subscribers, like presence
+func (h *Hub) PublishEphemeral(ctx context.Context, topic string, eventType string, actorId int64, data any) error {
+	return h.publish(ctx, topic, eventType, actorId, data, true)
+}
+
+func (h *Hub) publish(ctx context.Context, topic string, eventType string, actorId int64, data any, ephemeral bool) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return h.broker.Publish(ctx, Event{
+		ID:        nextEventID(),
+		Topic:     topic,
+		Type:      eventType,
+		Data:      payload,
+		Ephemeral: ephemeral,
+		ActorID:   actorId,
+	})
+}
+
+// Subscribe registers a subscriber to topics and returns the events newer
+// than lastEventID still in the history, 0 skips the replay. Once the hub is
+// closed the subscriber's events channel is already closed
+func (h *Hub) Subscribe(topics []string, lastEventID int64) (*Subscriber, []Event) {
+	sub := &Subscriber{
+		topics: map[string]bool{},
+		events: make(chan Event, h.cfg.BufferSize),
+	}
+	for _, topic := range topics {
+		sub.topics[topic] = true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		sub.closed = true
+		close(sub.events)
+		return sub, []Event{}
+	}
+
+	for topic := range sub.topics {
+		if h.topics[topic] == nil {
+			h.topics[topic] = map[*Subscriber]bool{}
+		}
+		h.topics[topic][sub] = true
+	}
+
+	// registering and reading the history under the same lock means no
+	// event is both replayed and delivered, or neither
+	replay := []Event{}
+	if lastEventID > 0 {
+		for _, event := range h.orderedHistory() {
+			if event.ID > lastEventID && sub.topics[event.Topic] {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	return sub, replay
+}
+
+// Join adds a topic to a live subscriber, it's a no-op once the subscriber
+// was dropped
+func (h *Hub) Join(sub *Subscriber, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if sub.closed || sub.topics[topic] {
+		return
+	}
+	sub.topics[topic] = true
+	if h.topics[topic] == nil {
+		h.topics[topic] = map[*Subscriber]bool{}
+	}
+	h.topics[topic][sub] = true
+}
+
+func (h *Hub) Leave(sub *Subscriber, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !sub.topics[topic] {
+		return
+	}
+	delete(sub.topics, topic)
+	delete(h.topics[topic], sub)
+	if len(h.topics[topic]) == 0 {
+		delete(h.topics, topic)
+	}
+}
+
+func (h *Hub) Unsubscribe(sub *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.remove(sub)
+}
+
+// Close drops every subscriber and the ones subscribing later, their events
+// channels are closed so the streams end. It's called on shutdown since the
+// server doesn't cancel the contexts of running requests
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for _, subs := range h.topics {
+		for sub := range subs {
+			h.remove(sub)
+		}
+	}
+}
+
+func (h *Hub) dispatch(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.record(event)
+
+	for sub := range h.topics[event.Topic] {
+		select {
+		case sub.events <- event:
+		default:
+			h.remove(sub)
+		}
+	}
+}
+
+// remove must be called with h.mu held
+func (h *Hub) remove(sub *Subscriber) {
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.events)
+
+	for topic := range sub.topics {
+		delete(h.topics[topic], sub)
+		if len(h.topics[topic]) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+// record adds the event to the history ring, must be called with h.mu held
+func (h *Hub) record(event Event) {
+	if h.cfg.HistorySize <= 0 || event.Ephemeral {
+		return
+	}
+
+	if len(h.history) < h.cfg.HistorySize {
+		h.history = append(h.history, event)
+		return
+	}
+	h.history[h.next] = event
+	h.next = (h.next + 1) % h.cfg.HistorySize
+}
+
+// orderedHistory returns the history oldest first, must be called with h.mu held
+func (h *Hub) orderedHistory() []Event {
+	return append(append([]Event{}, h.history[h.next:]...), h.history[:h.next]...)
+}
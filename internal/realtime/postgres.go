@@ -0,0 +1,79 @@
+package realtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	listenerMinReconnect = 10 * time.Second
+	listenerMaxReconnect = time.Minute
+	listenerPingInterval = 90 * time.Second
+)
+
+// PostgresBroker relays the events through LISTEN/NOTIFY so every replica
+// connected to the same database receives them. Notify payloads are limited to
+// 8000 bytes, events should carry ids rather than full resources
+type PostgresBroker struct {
+	db      *sql.DB
+	dsn     string
+	channel string
+}
+
+func NewPostgresBroker(db *sql.DB, dsn string, channel string) *PostgresBroker {
+	return &PostgresBroker{db: db, dsn: dsn, channel: channel}
+}
+
+func (b *PostgresBroker) Publish(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", b.channel, string(payload))
+	return err
+}
+
+func (b *PostgresBroker) Run(ctx context.Context, deliver func(Event)) error {
+	listener := pq.NewListener(b.dsn, listenerMinReconnect, listenerMaxReconnect, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Error().Err(err).Int("event", int(ev)).Msg("realtime listener error")
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(b.channel); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case n := <-listener.Notify:
+			// a nil notification means the connection was re-established,
+			// events sent in between are lost and clients resume from history
+			if n == nil {
+				continue
+			}
+
+			var event Event
+			if err := json.Unmarshal([]byte(n.Extra), &event); err != nil {
+				log.Error().Err(err).Msg("invalid realtime event payload")
+				continue
+			}
+			deliver(event)
+		case <-time.After(listenerPingInterval):
+			go func() {
+				if err := listener.Ping(); err != nil {
+					log.Error().Err(err).Msg("realtime listener ping failed")
+				}
+			}()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
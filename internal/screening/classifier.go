@@ -0,0 +1,63 @@
+package screening
+
+import (
+	"context"
+	"strconv"
+)
+
+type Classification struct {
+	// Score is the probability of the text being abusive, from 0 to 1
+	Score float64
+	Label string
+}
+
+// Classifier is implemented by the external moderation services
+type Classifier interface {
+	Classify(ctx context.Context, text string) (Classification, error)
+}
+
+// StubClassifier gives every text the same score, it stands in for an
+// external classifier locally and in development
+type StubClassifier struct {
+	Score float64
+}
+
+func (s StubClassifier) Classify(ctx context.Context, text string) (Classification, error) {
+	return Classification{Score: s.Score, Label: "stub"}, nil
+}
+
+type ClassifierConfig struct {
+	// FlagScore and RejectScore are the thresholds of each verdict, 0 disables it
+	FlagScore   float64
+	RejectScore float64
+}
+
+type ClassifierChecker struct {
+	classifier Classifier
+	cfg        ClassifierConfig
+}
+
+func NewClassifierChecker(classifier Classifier, cfg ClassifierConfig) *ClassifierChecker {
+	return &ClassifierChecker{classifier: classifier, cfg: cfg}
+}
+
+func (c *ClassifierChecker) Name() string {
+	return "classifier"
+}
+
+func (c *ClassifierChecker) Check(ctx context.Context, content Content) (Result, error) {
+	class, err := c.classifier.Classify(ctx, content.FullText())
+	if err != nil {
+		return Result{}, err
+	}
+
+	reason := "classified as " + class.Label + " with score " + strconv.FormatFloat(class.Score, 'f', 2, 64)
+	switch {
+	case c.cfg.RejectScore > 0 && class.Score >= c.cfg.RejectScore:
+		return Result{Verdict: Reject, Reason: reason}, nil
+	case c.cfg.FlagScore > 0 && class.Score >= c.cfg.FlagScore:
+		return Result{Verdict: Flag, Reason: reason}, nil
+	}
+
+	return Result{Verdict: Allow}, nil
+}
@@ -0,0 +1,184 @@
+package screening
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shehab910/social/internal/store"
+)
+
+type RuleSource interface {
+	GetRules(ctx context.Context) ([]store.ScreeningRule, error)
+}
+
+type compiledRule struct {
+	rule store.ScreeningRule
+	re   *regexp.Regexp
+}
+
+// RuleCache keeps the admin managed rules in memory, they're reloaded once
+// older than ttl or right away after Invalidate
+type RuleCache struct {
+	source RuleSource
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	loadedAt time.Time
+	text     []compiledRule
+	domains  []store.ScreeningRule
+}
+
+func NewRuleCache(source RuleSource, ttl time.Duration) *RuleCache {
+	return &RuleCache{source: source, ttl: ttl}
+}
+
+// Invalidate makes the next check reload the rules
+func (c *RuleCache) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.loadedAt = time.Time{}
+}
+
+// CompileRule returns the regexp matching a word or regex rule
+func CompileRule(kind string, pattern string) (*regexp.Regexp, error) {
+	if kind == store.ScreeningRuleWord {
+		return regexp.Compile(`(?i)\b` + regexp.QuoteMeta(pattern) + `\b`)
+	}
+	return regexp.Compile(pattern)
+}
+
+func (c *RuleCache) load(ctx context.Context) ([]compiledRule, []store.ScreeningRule, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.loadedAt.IsZero() && time.Since(c.loadedAt) < c.ttl {
+		return c.text, c.domains, nil
+	}
+
+	rules, err := c.source.GetRules(ctx)
+	if err != nil {
+		// stale rules are better than none
+		if !c.loadedAt.IsZero() {
+			log.Error().Err(err).Msg("failed to reload screening rules")
+			return c.text, c.domains, nil
+		}
+		return nil, nil, err
+	}
+
+	text := []compiledRule{}
+	domains := []store.ScreeningRule{}
+	for _, rule := range rules {
+		if rule.Kind == store.ScreeningRuleDomain {
+			rule.Pattern = strings.ToLower(strings.TrimPrefix(rule.Pattern, "."))
+			domains = append(domains, rule)
+			continue
+		}
+
+		re, err := CompileRule(rule.Kind, rule.Pattern)
+		if err != nil {
+			log.Error().Err(err).Int64("ruleId", rule.ID).Msg("skipping invalid screening rule")
+			continue
+		}
+		text = append(text, compiledRule{rule: rule, re: re})
+	}
+
+	c.text, c.domains, c.loadedAt = text, domains, time.Now()
+	return text, domains, nil
+}
+
+// ruleResult turns a matched rule into a result, the default reason names the pattern
+func ruleResult(rule store.ScreeningRule, fallback string) Result {
+	reason := fallback
+	if rule.Reason != nil && *rule.Reason != "" {
+		reason = *rule.Reason
+	}
+
+	if rule.Action == string(Reject) {
+		return Result{Verdict: Reject, Reason: reason}
+	}
+	return Result{Verdict: Flag, Reason: reason}
+}
+
+// WordFilter matches the text against the word and regex rules, a matching
+// reject rule wins over the flag ones
+type WordFilter struct {
+	rules *RuleCache
+}
+
+func NewWordFilter(rules *RuleCache) *WordFilter {
+	return &WordFilter{rules: rules}
+}
+
+func (f *WordFilter) Name() string {
+	return "word_filter"
+}
+
+func (f *WordFilter) Check(ctx context.Context, content Content) (Result, error) {
+	rules, _, err := f.rules.load(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	text := content.FullText()
+	res := Result{Verdict: Allow}
+	for _, r := range rules {
+		if !r.re.MatchString(text) {
+			continue
+		}
+		res = ruleResult(r.rule, "matched a blocked "+r.rule.Kind)
+		if res.Verdict == Reject {
+			break
+		}
+	}
+
+	return res, nil
+}
+
+// linkRegex captures the host of the links, with or without a scheme
+var linkRegex = regexp.MustCompile(`(?i)(?:https?://|\bwww\.)([a-z0-9-]+(?:\.[a-z0-9-]+)+)`)
+
+// DomainBlocklist matches the linked hosts against the domain rules, a rule
+// covers the domain and its subdomains
+type DomainBlocklist struct {
+	rules *RuleCache
+}
+
+func NewDomainBlocklist(rules *RuleCache) *DomainBlocklist {
+	return &DomainBlocklist{rules: rules}
+}
+
+func (b *DomainBlocklist) Name() string {
+	return "domain_blocklist"
+}
+
+func (b *DomainBlocklist) Check(ctx context.Context, content Content) (Result, error) {
+	_, domains, err := b.rules.load(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	res := Result{Verdict: Allow}
+	if len(domains) == 0 {
+		return res, nil
+	}
+
+	for _, m := range linkRegex.FindAllStringSubmatch(content.FullText(), -1) {
+		host := strings.ToLower(m[1])
+		for _, rule := range domains {
+			if host != rule.Pattern && !strings.HasSuffix(host, "."+rule.Pattern) {
+				continue
+			}
+			res = ruleResult(rule, "links to a blocked domain "+rule.Pattern)
+			if res.Verdict == Reject {
+				return res, nil
+			}
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,100 @@
+package screening
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+type Verdict string
+
+const (
+	Allow Verdict = "allow"
+	// Flag lets the content through and queues it for moderator review
+	Flag   Verdict = "flag"
+	Reject Verdict = "reject"
+)
+
+const (
+	KindPost    = "post"
+	KindComment = "comment"
+)
+
+// Content is the text about to be published
+type Content struct {
+	Kind     string
+	AuthorID int64
+	// PostID is the edited post, 0 for new content
+	PostID int64
+	Title  string
+	Text   string
+}
+
+// FullText is the title and text checked as a whole
+func (c Content) FullText() string {
+	if c.Title == "" {
+		return c.Text
+	}
+	return c.Title + "\n" + c.Text
+}
+
+type Result struct {
+	Verdict Verdict `json:"verdict"`
+	Checker string  `json:"checker"`
+	Reason  string  `json:"reason,omitempty"`
+}
+
+type Checker interface {
+	Name() string
+	Check(ctx context.Context, content Content) (Result, error)
+}
+
+type Decision struct {
+	Verdict Verdict
+	// Results holds the flags and the rejection that decided the verdict
+	Results []Result
+}
+
+// Reason describes why the content was flagged or rejected
+func (d Decision) Reason() string {
+	reasons := make([]string, 0, len(d.Results))
+	for _, res := range d.Results {
+		reasons = append(reasons, res.Checker+": "+res.Reason)
+	}
+	return strings.Join(reasons, "; ")
+}
+
+type Pipeline struct {
+	checkers []Checker
+}
+
+func NewPipeline(checkers ...Checker) *Pipeline {
+	return &Pipeline{checkers: checkers}
+}
+
+// Run passes the content through the checkers in order and returns the
+// strictest verdict, a rejection stops the chain. A failing checker is logged
+// and skipped so an outage of one of them doesn't block publishing
+func (p *Pipeline) Run(ctx context.Context, content Content) Decision {
+	decision := Decision{Verdict: Allow, Results: []Result{}}
+
+	for _, checker := range p.checkers {
+		res, err := checker.Check(ctx, content)
+		if err != nil {
+			log.Error().Err(err).Str("checker", checker.Name()).Str("kind", content.Kind).Msg("screening checker failed")
+			continue
+		}
+		res.Checker = checker.Name()
+
+		switch res.Verdict {
+		case Reject:
+			return Decision{Verdict: Reject, Results: []Result{res}}
+		case Flag:
+			decision.Verdict = Flag
+			decision.Results = append(decision.Results, res)
+		}
+	}
+
+	return decision
+}
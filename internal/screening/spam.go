@@ -0,0 +1,52 @@
+package screening
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+type DuplicateCounter interface {
+	CountRecentDuplicates(ctx context.Context, authorId int64, text string, since time.Time, excludePostId int64) (int, error)
+}
+
+type DuplicateConfig struct {
+	// Window is how far back the author's content is compared
+	Window time.Duration
+	// FlagAt and RejectAt are the number of copies, this one included,
+	// flagging or rejecting the content, 0 disables the verdict
+	FlagAt   int
+	RejectAt int
+}
+
+// DuplicateChecker catches authors posting the same text over and over
+type DuplicateChecker struct {
+	counter DuplicateCounter
+	cfg     DuplicateConfig
+}
+
+func NewDuplicateChecker(counter DuplicateCounter, cfg DuplicateConfig) *DuplicateChecker {
+	return &DuplicateChecker{counter: counter, cfg: cfg}
+}
+
+func (c *DuplicateChecker) Name() string {
+	return "duplicate_content"
+}
+
+func (c *DuplicateChecker) Check(ctx context.Context, content Content) (Result, error) {
+	count, err := c.counter.CountRecentDuplicates(ctx, content.AuthorID, content.Text, time.Now().Add(-c.cfg.Window), content.PostID)
+	if err != nil {
+		return Result{}, err
+	}
+
+	copies := count + 1
+	reason := "same text posted " + strconv.Itoa(copies) + " times within " + c.cfg.Window.String()
+	switch {
+	case c.cfg.RejectAt > 0 && copies >= c.cfg.RejectAt:
+		return Result{Verdict: Reject, Reason: reason}, nil
+	case c.cfg.FlagAt > 0 && copies >= c.cfg.FlagAt:
+		return Result{Verdict: Flag, Reason: reason}, nil
+	}
+
+	return Result{Verdict: Allow}, nil
+}
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	AuditLogin              = "auth.login"
+	AuditLoginFailed        = "auth.login_failed"
+	AuditRoleChange         = "user.role_change"
+	AuditPostDelete         = "post.delete"
+	AuditReportClaim        = "moderation.report_claim"
+	AuditReportResolve      = "moderation.report_resolve"
+	AuditUserSuspend        = "moderation.user_suspend"
+	AuditUserLiftSuspension = "moderation.user_lift_suspension"
+	AuditScreeningRuleAdd   = "moderation.screening_rule_create"
+	AuditScreeningRuleDel   = "moderation.screening_rule_delete"
+	AuditDeletionRequest    = "user.deletion_request"
+	AuditDeletionCancel     = "user.deletion_cancel"
+	AuditAccountPurge       = "user.purge"
+)
+
+const (
+	AuditTargetUser          = "user"
+	AuditTargetPost          = "post"
+	AuditTargetReport        = "report"
+	AuditTargetScreeningRule = "screening_rule"
+)
+
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	ActorID    *int64          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType *string         `json:"target_type"`
+	TargetID   *int64          `json:"target_id"`
+	IP         *string         `json:"ip"`
+	RequestID  *string         `json:"request_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type AuditFilter struct {
+	ActorID    *int64     `json:"actor_id"`
+	Action     string     `json:"action" validate:"omitempty,max=50"`
+	TargetType string     `json:"target_type" validate:"omitempty,max=20"`
+	TargetID   *int64     `json:"target_id"`
+	Since      *time.Time `json:"since"`
+	Until      *time.Time `json:"until"`
+}
+
+func (af *AuditFilter) Parse(r *http.Request) error {
+	qs := r.URL.Query()
+
+	actorId := qs.Get("actor_id")
+	if actorId != "" {
+		id, err := strconv.ParseInt(actorId, 10, 64)
+		if err != nil {
+			return err
+		}
+		af.ActorID = &id
+	}
+
+	targetId := qs.Get("target_id")
+	if targetId != "" {
+		id, err := strconv.ParseInt(targetId, 10, 64)
+		if err != nil {
+			return err
+		}
+		af.TargetID = &id
+	}
+
+	since := qs.Get("since")
+	if since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return err
+		}
+		af.Since = &t
+	}
+
+	until := qs.Get("until")
+	if until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return err
+		}
+		af.Until = &t
+	}
+
+	af.Action = qs.Get("action")
+	af.TargetType = qs.Get("target_type")
+
+	return nil
+}
+
+type AuditStore struct {
+	db DBTX
+}
+
+// nullJSON stores empty and null snapshots as NULL
+func nullJSON(raw json.RawMessage) any {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil
+	}
+	return []byte(raw)
+}
+
+func (s *AuditStore) Create(ctx context.Context, entry *AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (actor_id, action, target_type, target_id, ip, request_id, before, after)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		entry.ActorID,
+		entry.Action,
+		entry.TargetType,
+		entry.TargetID,
+		entry.IP,
+		entry.RequestID,
+		nullJSON(entry.Before),
+		nullJSON(entry.After),
+	).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// auditFilterClause binds the filter to $1 - $6
+const auditFilterClause = `
+	($1::bigint IS NULL OR actor_id = $1)
+	AND ($2 = '' OR action = $2)
+	AND ($3 = '' OR target_type = $3)
+	AND ($4::bigint IS NULL OR target_id = $4)
+	AND ($5::timestamp with time zone IS NULL OR created_at >= $5)
+	AND ($6::timestamp with time zone IS NULL OR created_at < $6)
+`
+
+func (f AuditFilter) args() []any {
+	return []any{f.ActorID, f.Action, f.TargetType, f.TargetID, f.Since, f.Until}
+}
+
+const auditColumns = `id, actor_id, action, target_type, target_id, ip, request_id, before, after, created_at`
+
+func scanAuditEntry(rows *sql.Rows, e *AuditEntry) error {
+	return rows.Scan(
+		&e.ID,
+		&e.ActorID,
+		&e.Action,
+		&e.TargetType,
+		&e.TargetID,
+		&e.IP,
+		&e.RequestID,
+		&e.Before,
+		&e.After,
+		&e.CreatedAt,
+	)
+}
+
+func (s *AuditStore) Query(ctx context.Context, filter AuditFilter, cq CursorPaginatedQuery) (CursorPage[AuditEntry], error) {
+	cursorTime, cursorId, err := cursorArgs(cq.Cursor)
+	if err != nil {
+		return CursorPage[AuditEntry]{}, err
+	}
+
+	query := `
+		SELECT ` + auditColumns + `
+		FROM audit_log
+		WHERE ` + auditFilterClause + `
+		AND ($7::timestamp with time zone IS NULL OR (created_at, id) < ($7, $8))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $9
+	`
+
+	// one extra row tells whether there is a next page
+	args := append(filter.args(), cursorTime, cursorId, cq.Limit+1)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return CursorPage[AuditEntry]{}, err
+	}
+	defer rows.Close()
+
+	page := CursorPage[AuditEntry]{Items: []AuditEntry{}}
+	for rows.Next() {
+		var e AuditEntry
+		if err := scanAuditEntry(rows, &e); err != nil {
+			return CursorPage[AuditEntry]{}, err
+		}
+		page.Items = append(page.Items, e)
+	}
+	if err := rows.Err(); err != nil {
+		return CursorPage[AuditEntry]{}, err
+	}
+
+	if len(page.Items) > cq.Limit {
+		page.Items = page.Items[:cq.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = EncodeCursor(last.CreatedAt, last.ID)
+	}
+
+	return page, nil
+}
+
+// Export calls fn with every matching entry, oldest first, without loading
+// them all in memory
+func (s *AuditStore) Export(ctx context.Context, filter AuditFilter, fn func(AuditEntry) error) error {
+	query := `
+		SELECT ` + auditColumns + `
+		FROM audit_log
+		WHERE ` + auditFilterClause + `
+		ORDER BY created_at, id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, filter.args()...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e AuditEntry
+		if err := scanAuditEntry(rows, &e); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
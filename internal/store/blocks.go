@@ -0,0 +1,125 @@
+package store
+
+import (
+	"context"
+
+	"github.com/lib/pq"
+)
+
+type BlockStore struct {
+	db DBTX
+}
+
+// Block records the block and removes the follow edges, follow requests and
+// timeline entries between both users in both directions
+func (s *BlockStore) Block(ctx context.Context, blockerId int64, blockedId int64) error {
+	tx, err := beginTx(ctx, s.db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insertQuery := `
+		INSERT INTO blocks(user_id, blocked_user_id)
+		VALUES ($1, $2)
+	`
+	if _, err := tx.ExecContext(ctx, insertQuery, blockerId, blockedId); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		return err
+	}
+
+	unfollowQuery := `
+		DELETE FROM followers
+		WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+	`
+	if _, err := tx.ExecContext(ctx, unfollowQuery, blockerId, blockedId); err != nil {
+		return err
+	}
+
+	requestsQuery := `
+		DELETE FROM follow_requests
+		WHERE (user_id = $1 AND requester_id = $2) OR (user_id = $2 AND requester_id = $1)
+	`
+	if _, err := tx.ExecContext(ctx, requestsQuery, blockerId, blockedId); err != nil {
+		return err
+	}
+
+	pruneQuery := `
+		DELETE FROM timelines
+		WHERE (user_id = $1 AND author_id = $2) OR (user_id = $2 AND author_id = $1)
+	`
+	if _, err := tx.ExecContext(ctx, pruneQuery, blockerId, blockedId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, blockerId int64, blockedId int64) error {
+	query := `
+		DELETE FROM blocks
+		WHERE user_id = $1 AND blocked_user_id = $2
+	`
+
+	_, err := s.db.ExecContext(ctx, query, blockerId, blockedId)
+	return err
+}
+
+// IsBlockedEither reports whether any of the two users blocked the other
+func (s *BlockStore) IsBlockedEither(ctx context.Context, userId int64, otherUserId int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM blocks
+			WHERE (user_id = $1 AND blocked_user_id = $2) OR (user_id = $2 AND blocked_user_id = $1)
+		)
+	`
+
+	var isBlocked bool
+	err := s.db.QueryRowContext(ctx, query, userId, otherUserId).Scan(&isBlocked)
+	if err != nil {
+		return false, err
+	}
+
+	return isBlocked, nil
+}
+
+func (s *BlockStore) GetBlockedUsers(ctx context.Context, userId int64) ([]User, error) {
+	query := `
+		SELECT u.id, u.username, u.image_url
+		FROM blocks b
+		JOIN users u
+		ON u.id = b.blocked_user_id
+		WHERE b.user_id = $1
+		ORDER BY b.created_at DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.ImgUrl); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// notBlockedClause returns a predicate excluding rows whose author column was
+// blocked by, or has blocked, the user bound to viewerParam
+func notBlockedClause(viewerParam string, authorColumn string) string {
+	return `NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.user_id = ` + viewerParam + ` AND b.blocked_user_id = ` + authorColumn + `)
+			OR (b.user_id = ` + authorColumn + ` AND b.blocked_user_id = ` + viewerParam + `)
+		)`
+}
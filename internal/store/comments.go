@@ -3,31 +3,41 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+
+	"github.com/shehab910/social/internal/entities"
 )
 
 type Comment struct {
-	ID        int64  `json:"id"`
-	PostID    int64  `json:"post_id"`
-	UserID    int64  `json:"user_id"`
-	Content   string `json:"content"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
-	User      User   `json:"user"`
+	ID     int64 `json:"id"`
+	PostID int64 `json:"post_id"`
+	UserID int64 `json:"user_id"`
+	// ParentCommentID is the comment this one replies to
+	ParentCommentID *int64        `json:"parent_comment_id,omitempty"`
+	Content         string        `json:"content"`
+	Entities        entities.List `json:"entities"`
+	CreatedAt       string        `json:"created_at"`
+	UpdatedAt       string        `json:"updated_at"`
+	User            User          `json:"user"`
 }
 
 type CommentStore struct {
-	db *sql.DB
+	db DBTX
 }
 
-func (s *CommentStore) GetByPostIdWithUser(ctx context.Context, postID int64) ([]Comment, error) {
+// viewerId is 0 for anonymous viewers
+func (s *CommentStore) GetByPostIdWithUser(ctx context.Context, postID int64, viewerId int64) ([]Comment, error) {
 	query := `
-		SELECT c.id, c.post_id, c.content, c.created_at, u.username, u.id
+		SELECT c.id, c.post_id, c.parent_comment_id, c.content, c.entities, c.created_at, u.username, u.id
 		FROM comments c
 		JOIN users u on u.id = c.user_id
 		WHERE c.post_id = $1
+		AND c.hidden_at IS NULL
+		AND ` + mutedCommentsClause("$2") + `
+		AND ` + notBlockedClause("$2", "c.user_id") + `
 		ORDER BY c.created_at desc;
 	`
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	rows, err := s.db.QueryContext(ctx, query, postID, viewerId)
 	if err != nil {
 		return nil, err
 	}
@@ -38,7 +48,7 @@ func (s *CommentStore) GetByPostIdWithUser(ctx context.Context, postID int64) ([
 	for rows.Next() {
 		var c Comment
 		c.User = User{}
-		err := rows.Scan(&c.ID, &c.PostID, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID)
+		err := rows.Scan(&c.ID, &c.PostID, &c.ParentCommentID, &c.Content, &c.Entities, &c.CreatedAt, &c.User.Username, &c.User.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -49,11 +59,11 @@ func (s *CommentStore) GetByPostIdWithUser(ctx context.Context, postID int64) ([
 
 func (s *CommentStore) Create(ctx context.Context, c *Comment) error {
 	query := `
-		INSERT INTO comments(post_id, user_id, content)
-		VALUES ($1, $2, $3)
+		INSERT INTO comments(post_id, user_id, parent_comment_id, content, entities)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at
 	`
-	err := s.db.QueryRowContext(ctx, query, c.PostID, c.UserID, c.Content).Scan(&c.ID, &c.CreatedAt)
+	err := s.db.QueryRowContext(ctx, query, c.PostID, c.UserID, c.ParentCommentID, c.Content, c.Entities).Scan(&c.ID, &c.CreatedAt)
 
 	if err != nil {
 		return err
@@ -61,3 +71,44 @@ func (s *CommentStore) Create(ctx context.Context, c *Comment) error {
 
 	return nil
 }
+
+// GetPostId returns the post of a visible comment, ErrNotFound if there's no such comment
+func (s *CommentStore) GetPostId(ctx context.Context, commentId int64) (int64, error) {
+	query := `
+		SELECT post_id
+		FROM comments
+		WHERE id = $1 AND hidden_at IS NULL
+	`
+
+	var postId int64
+	err := s.db.QueryRowContext(ctx, query, commentId).Scan(&postId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+
+	return postId, nil
+}
+
+// GetAuthorId returns the author of a visible comment of the post, ErrNotFound
+// if the post has no such comment
+func (s *CommentStore) GetAuthorId(ctx context.Context, postId int64, commentId int64) (int64, error) {
+	query := `
+		SELECT user_id
+		FROM comments
+		WHERE id = $1 AND post_id = $2 AND hidden_at IS NULL
+	`
+
+	var authorId int64
+	err := s.db.QueryRowContext(ctx, query, commentId, postId).Scan(&authorId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+
+	return authorId, nil
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+type CursorPaginatedQuery struct {
+	Limit  int    `json:"limit" validate:"required,gte=1,lte=50"`
+	Cursor string `json:"cursor" validate:"omitempty,max=100"`
+	Search string `json:"search" validate:"omitempty,max=100"`
+}
+
+func (cq *CursorPaginatedQuery) Parse(r *http.Request) error {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return err
+		}
+		cq.Limit = l
+	}
+
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		cq.Cursor = cursor
+	}
+
+	search := qs.Get("search")
+	if search != "" {
+		cq.Search = search
+	}
+
+	return nil
+}
+
+// CursorFeedQuery has the filters of PaginatedFeedQuery, pages are newest
+// first and follow each other by cursor
+type CursorFeedQuery struct {
+	Limit  int      `json:"limit" validate:"required,gte=1,lte=50"`
+	Cursor string   `json:"cursor" validate:"omitempty,max=100"`
+	Tags   []string `json:"tags" validate:"omitempty"`
+	Search string   `json:"search" validate:"omitempty"`
+	Since  string   `json:"since" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+	Until  string   `json:"until" validate:"omitempty,datetime=2006-01-02T15:04:05Z07:00"`
+}
+
+func (fq *CursorFeedQuery) Parse(r *http.Request) error {
+	qs := r.URL.Query()
+
+	limit := qs.Get("limit")
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return err
+		}
+		fq.Limit = l
+	}
+
+	cursor := qs.Get("cursor")
+	if cursor != "" {
+		fq.Cursor = cursor
+	}
+
+	tags := qs.Get("tags")
+	if tags != "" {
+		fq.Tags = strings.Split(tags, ",")
+	}
+
+	search := qs.Get("search")
+	if search != "" {
+		fq.Search = search
+	}
+
+	since := qs.Get("since")
+	if since != "" {
+		fq.Since = since
+	}
+
+	until := qs.Get("until")
+	if until != "" {
+		fq.Until = until
+	}
+
+	return nil
+}
+
+// Cursor points right after the last returned row of a page ordered by (created_at, id) desc
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+type CursorPage[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+func EncodeCursor(createdAt time.Time, id int64) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + strconv.FormatInt(id, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(cursor string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	parsedId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return Cursor{CreatedAt: t, ID: parsedId}, nil
+}
+
+// cursorArgs returns the (created_at, id) query args of an optional cursor,
+// created_at is NULL for the first page
+func cursorArgs(cursor string) (sql.NullTime, int64, error) {
+	if cursor == "" {
+		return sql.NullTime{}, 0, nil
+	}
+
+	c, err := DecodeCursor(cursor)
+	if err != nil {
+		return sql.NullTime{}, 0, err
+	}
+
+	return sql.NullTime{Time: c.CreatedAt, Valid: true}, c.ID, nil
+}
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// What happens to the posts and comments of a purged account
+const (
+	DeletionContentDelete    = "delete"
+	DeletionContentAnonymize = "anonymize"
+)
+
+// anonymized content is moved to a placeholder account that can't log in,
+// it's the system user created by the migrations
+const deletedUserUsername = "deleted"
+
+var errNoDeletedUser = errors.New("the placeholder account of deleted users is missing, run the migrations")
+
+// IsReservedUsername reports whether username belongs to a system account
+// and can't be registered
+func IsReservedUsername(username string) bool {
+	return strings.EqualFold(username, deletedUserUsername)
+}
+
+type AccountDeletionStore struct {
+	db DBTX
+}
+
+// Request schedules the deletion of the account and returns when it was
+// requested, asking again keeps the original request time
+func (s *AccountDeletionStore) Request(ctx context.Context, userId int64) (time.Time, error) {
+	query := `
+		UPDATE users
+		SET deletion_requested_at = COALESCE(deletion_requested_at, now())
+		WHERE id = $1
+		RETURNING deletion_requested_at
+	`
+
+	var requestedAt time.Time
+	if err := s.db.QueryRowContext(ctx, query, userId).Scan(&requestedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, ErrNotFound
+		}
+		return time.Time{}, err
+	}
+
+	return requestedAt, nil
+}
+
+// Cancel clears a pending deletion request, it reports whether there was one
+func (s *AccountDeletionStore) Cancel(ctx context.Context, userId int64) (bool, error) {
+	query := `
+		UPDATE users
+		SET deletion_requested_at = NULL
+		WHERE id = $1 AND deletion_requested_at IS NOT NULL
+	`
+
+	res, err := s.db.ExecContext(ctx, query, userId)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+// GetDue returns the ids of up to limit accounts whose grace period is over
+func (s *AccountDeletionStore) GetDue(ctx context.Context, grace time.Duration, limit int) ([]int64, error) {
+	query := `
+		SELECT id
+		FROM users
+		WHERE deletion_requested_at <= now() - make_interval(secs => $1)
+		ORDER BY deletion_requested_at
+		LIMIT $2
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, grace.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Purge permanently deletes the account if its grace period is still over,
+// ErrNotFound otherwise (e.g. the user logged in meanwhile). Depending on
+// content the posts and comments are deleted along with the account or moved
+// to the placeholder account. The files of the user's data exports are
+// returned so they can be removed, their rows cascade like the rest of the
+// personal data
+func (s *AccountDeletionStore) Purge(ctx context.Context, userId int64, grace time.Duration, content string) ([]string, error) {
+	tx, err := beginTx(ctx, s.db, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	lockQuery := `
+		SELECT id
+		FROM users
+		WHERE id = $1 AND deletion_requested_at <= now() - make_interval(secs => $2)
+		FOR UPDATE
+	`
+	if err := tx.QueryRowContext(ctx, lockQuery, userId, grace.Seconds()).Scan(&userId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	paths, err := exportFiles(ctx, tx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if content == DeletionContentAnonymize {
+		if err := anonymizeContent(ctx, tx, userId); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userId); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+func exportFiles(ctx context.Context, tx DBTX, userId int64) ([]string, error) {
+	query := `SELECT file_path FROM data_exports WHERE user_id = $1 AND status = 'ready'`
+
+	rows, err := tx.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := []string{}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, rows.Err()
+}
+
+// anonymizeContent moves the user's posts, comments and the mentions they
+// wrote to the placeholder account so they survive the delete
+func anonymizeContent(ctx context.Context, tx DBTX, userId int64) error {
+	placeholderId, err := deletedUserId(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	queries := []string{
+		`UPDATE posts SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE comments SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE mentions SET author_id = $2 WHERE author_id = $1`,
+	}
+	for _, query := range queries {
+		if _, err := tx.ExecContext(ctx, query, userId, placeholderId); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deletedUserId returns the placeholder account. Its password is empty so no
+// hash ever matches it
+func deletedUserId(ctx context.Context, tx DBTX) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE is_system`).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errNoDeletedUser
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
@@ -0,0 +1,337 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ExportStatusPending = "pending"
+	ExportStatusReady   = "ready"
+	ExportStatusFailed  = "failed"
+	ExportStatusExpired = "expired"
+)
+
+type DataExport struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Status      string     `json:"status"`
+	FilePath    *string    `json:"-"`
+	Error       *string    `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// UserArchive is everything a user can download about themself
+type UserArchive struct {
+	Profile   User             `json:"profile"`
+	Posts     []Post           `json:"posts"`
+	Comments  []Comment        `json:"comments"`
+	Followers []ArchivedFollow `json:"followers"`
+	Following []ArchivedFollow `json:"following"`
+	Media     []ArchivedMedia  `json:"media"`
+}
+
+type ArchivedFollow struct {
+	UserID     int64  `json:"user_id"`
+	Username   string `json:"username"`
+	FollowedAt string `json:"followed_at"`
+}
+
+type ArchivedMedia struct {
+	Kind string `json:"kind"`
+	URL  string `json:"url"`
+}
+
+type ExportStore struct {
+	db DBTX
+}
+
+// Create starts an export of the user, it returns ErrConflict while another
+// one is pending. Pending exports older than staleAfter are failed first, they
+// were left behind by a stopped server
+func (s *ExportStore) Create(ctx context.Context, userId int64, staleAfter time.Duration) (*DataExport, error) {
+	tx, err := beginTx(ctx, s.db, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	staleQuery := `
+		UPDATE data_exports
+		SET status = 'failed', error = 'timed out', completed_at = now()
+		WHERE user_id = $1 AND status = 'pending' AND created_at < now() - make_interval(secs => $2)
+	`
+	if _, err := tx.ExecContext(ctx, staleQuery, userId, staleAfter.Seconds()); err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO data_exports (user_id)
+		VALUES ($1)
+		RETURNING id, user_id, status, created_at
+	`
+
+	export := &DataExport{}
+	err = tx.QueryRowContext(ctx, query, userId).Scan(&export.ID, &export.UserID, &export.Status, &export.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, ErrConflict
+		}
+		return nil, err
+	}
+
+	return export, tx.Commit()
+}
+
+func (s *ExportStore) GetById(ctx context.Context, exportId int64) (*DataExport, error) {
+	query := `
+		SELECT id, user_id, status, file_path, error, created_at, completed_at, expires_at
+		FROM data_exports
+		WHERE id = $1
+	`
+
+	var e DataExport
+	err := s.db.QueryRowContext(ctx, query, exportId).Scan(
+		&e.ID,
+		&e.UserID,
+		&e.Status,
+		&e.FilePath,
+		&e.Error,
+		&e.CreatedAt,
+		&e.CompletedAt,
+		&e.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &e, nil
+}
+
+func (s *ExportStore) MarkReady(ctx context.Context, export *DataExport, filePath string, expiresAt time.Time) error {
+	query := `
+		UPDATE data_exports
+		SET status = 'ready', file_path = $2, completed_at = now(), expires_at = $3
+		WHERE id = $1
+		RETURNING status, completed_at
+	`
+
+	export.FilePath = &filePath
+	export.ExpiresAt = &expiresAt
+	return s.db.QueryRowContext(ctx, query, export.ID, filePath, expiresAt).Scan(&export.Status, &export.CompletedAt)
+}
+
+func (s *ExportStore) MarkFailed(ctx context.Context, exportId int64, reason string) error {
+	query := `
+		UPDATE data_exports
+		SET status = 'failed', error = $2, completed_at = now()
+		WHERE id = $1
+	`
+
+	_, err := s.db.ExecContext(ctx, query, exportId, reason)
+	return err
+}
+
+// ExpireReady marks the ready exports past their expiry as expired and
+// returns their files so they can be deleted
+func (s *ExportStore) ExpireReady(ctx context.Context) ([]string, error) {
+	query := `
+		UPDATE data_exports
+		SET status = 'expired'
+		WHERE status = 'ready' AND expires_at <= now()
+		RETURNING file_path
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := []string{}
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	}
+
+	return paths, rows.Err()
+}
+
+// Collect reads the user's data from a single snapshot of the db
+func (s *ExportStore) Collect(ctx context.Context, userId int64) (*UserArchive, error) {
+	tx, err := beginTx(ctx, s.db, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	archive := &UserArchive{}
+
+	profileQuery := `
+		SELECT id, username, email, bio, image_url, role, verified, is_private, dm_policy, last_login_at, created_at, updated_at
+		FROM users
+		WHERE id = $1
+	`
+	p := &archive.Profile
+	err = tx.QueryRowContext(ctx, profileQuery, userId).Scan(
+		&p.ID,
+		&p.Username,
+		&p.Email,
+		&p.Bio,
+		&p.ImgUrl,
+		&p.Role,
+		&p.Verified,
+		&p.IsPrivate,
+		&p.DMPolicy,
+		&p.LastLoginAt,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	if archive.Posts, err = collectPosts(ctx, tx, userId); err != nil {
+		return nil, err
+	}
+
+	if archive.Comments, err = collectComments(ctx, tx, userId); err != nil {
+		return nil, err
+	}
+
+	if archive.Followers, err = collectFollows(ctx, tx, "f.follower_id", "f.user_id", userId); err != nil {
+		return nil, err
+	}
+
+	if archive.Following, err = collectFollows(ctx, tx, "f.user_id", "f.follower_id", userId); err != nil {
+		return nil, err
+	}
+
+	archive.Media = []ArchivedMedia{}
+	if p.ImgUrl != nil && *p.ImgUrl != "" {
+		archive.Media = append(archive.Media, ArchivedMedia{Kind: "profile_image", URL: *p.ImgUrl})
+	}
+
+	return archive, tx.Commit()
+}
+
+// collectPosts includes the drafts, scheduled and trashed posts
+func collectPosts(ctx context.Context, tx DBTX, userId int64) ([]Post, error) {
+	query := `
+		SELECT id, title, content, user_id, tags, entities, visibility, status, publish_at, deleted_at, created_at, updated_at
+		FROM posts
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := tx.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.Title,
+			&p.Content,
+			&p.UserID,
+			pq.Array(&p.Tags),
+			&p.Entities,
+			&p.Visibility,
+			&p.Status,
+			&p.PublishAt,
+			&p.DeletedAt,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
+func collectComments(ctx context.Context, tx DBTX, userId int64) ([]Comment, error) {
+	query := `
+		SELECT id, post_id, user_id, parent_comment_id, content, entities, created_at, updated_at
+		FROM comments
+		WHERE user_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := tx.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		var c Comment
+		err := rows.Scan(
+			&c.ID,
+			&c.PostID,
+			&c.UserID,
+			&c.ParentCommentID,
+			&c.Content,
+			&c.Entities,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+
+	return comments, rows.Err()
+}
+
+// collectFollows lists the users in listedColumn of the follow edges whose ownerColumn is userId
+func collectFollows(ctx context.Context, tx DBTX, listedColumn string, ownerColumn string, userId int64) ([]ArchivedFollow, error) {
+	query := `
+		SELECT u.id, u.username, f.created_at
+		FROM followers f
+		JOIN users u
+		ON u.id = ` + listedColumn + `
+		WHERE ` + ownerColumn + ` = $1
+		ORDER BY f.created_at, u.id
+	`
+
+	rows, err := tx.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	follows := []ArchivedFollow{}
+	for rows.Next() {
+		var f ArchivedFollow
+		if err := rows.Scan(&f.UserID, &f.Username, &f.FollowedAt); err != nil {
+			return nil, err
+		}
+		follows = append(follows, f)
+	}
+
+	return follows, rows.Err()
+}
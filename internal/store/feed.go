@@ -0,0 +1,140 @@
+package store
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type FeedOptions struct {
+	// IncludeOwnPosts adds the viewer's own posts to the feed
+	IncludeOwnPosts bool `json:"include_own_posts"`
+	// IncludeReplies adds posts that followed users commented on
+	IncludeReplies bool `json:"include_replies"`
+	// IncludeFollowedTags adds posts of non-followed users tagged with a followed tag
+	IncludeFollowedTags bool `json:"include_followed_tags"`
+	// HideSuspendedAuthors leaves out the posts of suspended users, it's a
+	// server setting and can't be changed by the viewer
+	HideSuspendedAuthors bool `json:"-"`
+}
+
+func (fo *FeedOptions) Parse(r *http.Request) error {
+	qs := r.URL.Query()
+
+	includeOwn := qs.Get("include_own")
+	if includeOwn != "" {
+		b, err := strconv.ParseBool(includeOwn)
+		if err != nil {
+			return err
+		}
+		fo.IncludeOwnPosts = b
+	}
+
+	includeReplies := qs.Get("include_replies")
+	if includeReplies != "" {
+		b, err := strconv.ParseBool(includeReplies)
+		if err != nil {
+			return err
+		}
+		fo.IncludeReplies = b
+	}
+
+	includeTags := qs.Get("include_tags")
+	if includeTags != "" {
+		b, err := strconv.ParseBool(includeTags)
+		if err != nil {
+			return err
+		}
+		fo.IncludeFollowedTags = b
+	}
+
+	return nil
+}
+
+// feedMembershipClause returns the query selecting the id and sort time of the
+// posts in the feed of the user bound to $1, newest first after the cursor
+// bound to $2 and $3. The fanned out timeline drives it, the posts of followed
+// celebrities (the follower threshold is bound to $9) and the optional sources
+// are merged at read time. Each source reads at most $4 rows by keyset and
+// applies every filter itself, so no post filtered out later shortens the
+// page. UNION returns a post matching several sources (e.g. mutual follows) once.
+func feedMembershipClause(opts FeedOptions) string {
+	sources := []string{
+		// posts fanned out on write
+		feedSource(opts, "timelines t JOIN posts p ON p.id = t.post_id", "t.user_id = $1", "t.created_at", "t.post_id"),
+		feedSource(opts, "posts p", `p.user_id IN (
+				SELECT cf.user_id
+				FROM followers cf
+				JOIN users cu
+				ON cu.id = cf.user_id
+				WHERE cf.follower_id = $1 AND cu.follower_count >= $9
+			)`, "p.created_at", "p.id"),
+	}
+
+	if opts.IncludeOwnPosts {
+		sources = append(sources, feedSource(opts, "posts p", "p.user_id = $1", "p.created_at", "p.id"))
+	}
+
+	if opts.IncludeReplies {
+		sources = append(sources, feedSource(opts, "posts p", `EXISTS (
+				SELECT 1
+				FROM comments rc
+				JOIN followers rf
+				ON rf.user_id = rc.user_id
+				WHERE rc.post_id = p.id AND rf.follower_id = $1
+			)`, "p.created_at", "p.id"))
+	}
+
+	if opts.IncludeFollowedTags {
+		sources = append(sources, feedSource(opts, "posts p", `EXISTS (
+				SELECT 1
+				FROM followed_tags ft, unnest(p.tags) AS pt(tag)
+				WHERE ft.user_id = $1 AND lower(pt.tag) = ft.tag
+			)`, "p.created_at", "p.id"))
+	}
+
+	return strings.Join(sources, "\n\t\tUNION\n\t\t")
+}
+
+// feedSource pages the posts (aliased p) of from matching where, ordered by
+// createdAt and id
+func feedSource(opts FeedOptions, from string, where string, createdAt string, id string) string {
+	return `(
+			SELECT p.id, ` + createdAt + ` AS created_at
+			FROM ` + from + `
+			JOIN users u
+			ON u.id = p.user_id
+			WHERE ` + where + `
+			AND ($2::timestamp with time zone IS NULL OR (` + createdAt + `, ` + id + `) < ($2, $3))
+			AND ` + feedPostFilter(opts) + `
+			ORDER BY ` + createdAt + ` DESC, ` + id + ` DESC
+			LIMIT $4
+		)`
+}
+
+// feedPostFilter returns the predicate every post (aliased p, author aliased u)
+// of the feed of the user bound to $1 passes, with the tags, search, since and
+// until filters bound to $5 to $8
+func feedPostFilter(opts FeedOptions) string {
+	clause := "p.status = 'published' AND p.deleted_at IS NULL AND p.hidden_at IS NULL"
+	if !opts.IncludeOwnPosts {
+		clause += " AND p.user_id <> $1"
+	}
+
+	clause += "\n\t\t\tAND " + mutedPostsClause("$1")
+	clause += "\n\t\t\tAND " + notBlockedClause("$1", "p.user_id")
+	clause += "\n\t\t\tAND " + visibleAuthorClause("$1")
+	clause += "\n\t\t\tAND " + visiblePostClause("$1")
+	clause += "\n\t\t\tAND " + activeAuthorClause(opts.HideSuspendedAuthors)
+	clause += `
+			AND ($5 = '{}' OR EXISTS (
+				SELECT 1
+				FROM unnest($5::text[]) AS search_tag
+				WHERE p.tags::text ILIKE '%' || search_tag || '%'
+			))
+			AND ($6 = '' OR p.content ILIKE '%' || $6 || '%' OR p.title ILIKE '%' || $6 || '%')
+			AND ($7 = '' OR p.created_at >= $7::timestamp with time zone)
+			AND ($8 = '' OR p.created_at <= $8::timestamp with time zone)`
+
+	return clause
+}
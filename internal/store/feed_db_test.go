@@ -0,0 +1,263 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/shehab910/social/internal/db"
+	"github.com/shehab910/social/internal/store"
+)
+
+// newTestStorage returns a Storage on a fresh schema of the TEST_DB_ADDR
+// database with every migration applied, the schema is dropped afterwards.
+// The test is skipped when TEST_DB_ADDR isn't set
+func newTestStorage(t *testing.T) (*store.Storage, *sql.DB) {
+	t.Helper()
+
+	addr := os.Getenv("TEST_DB_ADDR")
+	if addr == "" {
+		t.Skip("TEST_DB_ADDR isn't set")
+	}
+
+	schema := fmt.Sprintf("social_test_%d", time.Now().UnixNano())
+	conn, err := db.New(addr, 5, 5, "1m", schema)
+	if err != nil {
+		t.Fatalf("connecting to the test db: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Exec(`DROP SCHEMA IF EXISTS ` + pq.QuoteIdentifier(schema) + ` CASCADE`)
+		conn.Close()
+	})
+
+	migrations, err := db.LoadMigrations(db.MigrationsFS, "migrations")
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	if _, err := db.NewMigrator(conn, schema, migrations).Up(context.Background()); err != nil {
+		t.Fatalf("migrating the test db: %v", err)
+	}
+
+	return store.NewStorage(conn), conn
+}
+
+// feedFixture creates the users and posts of a feed test through the stores,
+// posts are fanned out like the timeline worker does
+type feedFixture struct {
+	t     *testing.T
+	ctx   context.Context
+	store *store.Storage
+	db    *sql.DB
+}
+
+func newFeedFixture(t *testing.T) *feedFixture {
+	s, conn := newTestStorage(t)
+	return &feedFixture{t: t, ctx: context.Background(), store: s, db: conn}
+}
+
+func (f *feedFixture) user(name string) int64 {
+	f.t.Helper()
+
+	user := &store.User{Username: name, Email: name + "@example.com", Password: "hash"}
+	if err := f.store.Users.Create(f.ctx, user); err != nil {
+		f.t.Fatalf("creating user %s: %v", name, err)
+	}
+	return user.ID
+}
+
+func (f *feedFixture) follow(followerId int64, followedId int64) {
+	f.t.Helper()
+
+	if err := f.store.Followers.Follow(f.ctx, followerId, followedId); err != nil {
+		f.t.Fatalf("following %d: %v", followedId, err)
+	}
+}
+
+// celebrity makes the user reach the celebrity follower count
+func (f *feedFixture) celebrity(userId int64) {
+	f.t.Helper()
+
+	_, err := f.db.ExecContext(f.ctx, `UPDATE users SET follower_count = $2 WHERE id = $1`, userId, store.CelebrityFollowerThreshold)
+	if err != nil {
+		f.t.Fatalf("making %d a celebrity: %v", userId, err)
+	}
+}
+
+func (f *feedFixture) post(userId int64, title string) int64 {
+	f.t.Helper()
+
+	post := &store.Post{Title: title, Content: title, UserID: userId, Tags: []string{}}
+	if err := f.store.Posts.Create(f.ctx, post); err != nil {
+		f.t.Fatalf("creating post %s: %v", title, err)
+	}
+	if err := f.store.Timelines.FanOut(f.ctx, post.ID); err != nil {
+		f.t.Fatalf("fanning out post %s: %v", title, err)
+	}
+	return post.ID
+}
+
+func (f *feedFixture) comment(userId int64, postId int64) {
+	f.t.Helper()
+
+	if err := f.store.Comments.Create(f.ctx, &store.Comment{PostID: postId, UserID: userId, Content: "comment"}); err != nil {
+		f.t.Fatalf("commenting post %d: %v", postId, err)
+	}
+}
+
+func (f *feedFixture) page(viewerId int64, opts store.FeedOptions, limit int, cursor string) store.CursorPage[store.PostWithMeta] {
+	f.t.Helper()
+
+	fq := store.CursorFeedQuery{Limit: limit, Cursor: cursor, Tags: []string{}}
+	page, err := f.store.Posts.GetUserFeed(f.ctx, viewerId, fq, opts)
+	if err != nil {
+		f.t.Fatalf("getting the feed of %d: %v", viewerId, err)
+	}
+	return page
+}
+
+// feed returns the ids of the first page of the feed, big enough for every post
+func (f *feedFixture) feed(viewerId int64, opts store.FeedOptions) []int64 {
+	f.t.Helper()
+
+	return postIds(f.page(viewerId, opts, 50, "").Items)
+}
+
+func postIds(posts []store.PostWithMeta) []int64 {
+	ids := []int64{}
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	return ids
+}
+
+func TestGetUserFeed(t *testing.T) {
+	t.Run("zero follows", func(t *testing.T) {
+		f := newFeedFixture(t)
+		viewer := f.user("viewer")
+		author := f.user("author")
+		f.post(author, "unfollowed")
+		f.post(viewer, "own")
+
+		got := f.feed(viewer, store.FeedOptions{IncludeReplies: true})
+		if len(got) != 0 {
+			t.Errorf("got posts %v, want an empty feed", got)
+		}
+	})
+
+	t.Run("mutual follows return each post once", func(t *testing.T) {
+		f := newFeedFixture(t)
+		viewer := f.user("viewer")
+		friend := f.user("friend")
+		f.follow(viewer, friend)
+		f.follow(friend, viewer)
+
+		first := f.post(friend, "first")
+		second := f.post(friend, "second")
+		f.post(viewer, "own")
+		// the friend's own comment adds the post to the replies source too
+		f.comment(friend, first)
+
+		got := f.feed(viewer, store.FeedOptions{IncludeReplies: true})
+		want := []int64{second, first}
+		if !slices.Equal(got, want) {
+			t.Errorf("got posts %v, want %v", got, want)
+		}
+	})
+
+	t.Run("own posts", func(t *testing.T) {
+		f := newFeedFixture(t)
+		viewer := f.user("viewer")
+		friend := f.user("friend")
+		f.follow(viewer, friend)
+
+		friendPost := f.post(friend, "friend")
+		ownPost := f.post(viewer, "own")
+
+		got := f.feed(viewer, store.FeedOptions{IncludeOwnPosts: true})
+		want := []int64{ownPost, friendPost}
+		if !slices.Equal(got, want) {
+			t.Errorf("with own posts got %v, want %v", got, want)
+		}
+
+		got = f.feed(viewer, store.FeedOptions{})
+		want = []int64{friendPost}
+		if !slices.Equal(got, want) {
+			t.Errorf("without own posts got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("celebrity posts are read at read time", func(t *testing.T) {
+		f := newFeedFixture(t)
+		viewer := f.user("viewer")
+		celebrity := f.user("celebrity")
+		f.follow(viewer, celebrity)
+		f.celebrity(celebrity)
+
+		post := f.post(celebrity, "celebrity")
+
+		var fannedOut int
+		err := f.db.QueryRowContext(f.ctx, `SELECT COUNT(*) FROM timelines WHERE post_id = $1`, post).Scan(&fannedOut)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fannedOut != 0 {
+			t.Errorf("celebrity post fanned out to %d timelines, want 0", fannedOut)
+		}
+
+		got := f.feed(viewer, store.FeedOptions{})
+		want := []int64{post}
+		if !slices.Equal(got, want) {
+			t.Errorf("got posts %v, want %v", got, want)
+		}
+	})
+
+	t.Run("keyset paging across sources", func(t *testing.T) {
+		f := newFeedFixture(t)
+		viewer := f.user("viewer")
+		friend := f.user("friend")
+		celebrity := f.user("celebrity")
+		f.follow(viewer, friend)
+		f.follow(viewer, celebrity)
+		f.celebrity(celebrity)
+
+		// alternating authors so every page mixes the timeline and the
+		// celebrity source
+		want := []int64{}
+		for i := range 7 {
+			author := friend
+			if i%2 == 1 {
+				author = celebrity
+			}
+			want = append([]int64{f.post(author, fmt.Sprintf("post %d", i))}, want...)
+		}
+		f.post(viewer, "own")
+
+		got := []int64{}
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > len(want) {
+				t.Fatalf("paging doesn't end, got %v so far", got)
+			}
+
+			page := f.page(viewer, store.FeedOptions{IncludeOwnPosts: false}, 3, cursor)
+			if len(page.Items) > 3 {
+				t.Fatalf("page has %d posts, want at most 3", len(page.Items))
+			}
+			got = append(got, postIds(page.Items)...)
+
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+
+		if !slices.Equal(got, want) {
+			t.Errorf("got posts %v, want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFeedOptionsParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		initial FeedOptions
+		want    FeedOptions
+		wantErr bool
+	}{
+		{
+			name:    "no params keeps the defaults",
+			query:   "",
+			initial: FeedOptions{IncludeReplies: true, HideSuspendedAuthors: true},
+			want:    FeedOptions{IncludeReplies: true, HideSuspendedAuthors: true},
+		},
+		{
+			name:  "self inclusion on",
+			query: "include_own=true",
+			want:  FeedOptions{IncludeOwnPosts: true},
+		},
+		{
+			name:    "self inclusion off overrides the default",
+			query:   "include_own=false",
+			initial: FeedOptions{IncludeOwnPosts: true},
+			want:    FeedOptions{},
+		},
+		{
+			name:  "replies and followed tags",
+			query: "include_replies=1&include_tags=t",
+			want:  FeedOptions{IncludeReplies: true, IncludeFollowedTags: true},
+		},
+		{
+			name:    "hiding suspended authors can't be changed by the viewer",
+			query:   "hide_suspended_authors=false",
+			initial: FeedOptions{HideSuspendedAuthors: true},
+			want:    FeedOptions{HideSuspendedAuthors: true},
+		},
+		{
+			name:    "invalid bool",
+			query:   "include_replies=maybe",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/users/feed?"+tt.query, nil)
+
+			opts := tt.initial
+			err := opts.Parse(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if opts != tt.want {
+				t.Errorf("got %+v, want %+v", opts, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+
+	"github.com/lib/pq"
+)
+
+type FollowRequest struct {
+	UserID      int64  `json:"user_id"`
+	RequesterID int64  `json:"requester_id"`
+	CreatedAt   string `json:"created_at"`
+	Requester   User   `json:"requester"`
+}
+
+type FollowRequestStore struct {
+	db DBTX
+}
+
+// Create returns ErrBlocked if any of the two users blocked the other
+func (s *FollowRequestStore) Create(ctx context.Context, requesterId int64, userId int64) error {
+	query := `
+		INSERT INTO follow_requests(user_id, requester_id)
+		SELECT $1, $2
+		WHERE ` + notBlockedClause("$2", "$1") + `
+	`
+
+	res, err := s.db.ExecContext(ctx, query, userId, requesterId)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrBlocked
+	}
+	return nil
+}
+
+func (s *FollowRequestStore) Delete(ctx context.Context, requesterId int64, userId int64) error {
+	query := `
+		DELETE FROM follow_requests
+		WHERE user_id = $1 AND requester_id = $2
+	`
+
+	res, err := s.db.ExecContext(ctx, query, userId, requesterId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Accept turns the pending request into a follow edge
+func (s *FollowRequestStore) Accept(ctx context.Context, requesterId int64, userId int64) error {
+	tx, err := beginTx(ctx, s.db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	deleteQuery := `
+		DELETE FROM follow_requests
+		WHERE user_id = $1 AND requester_id = $2
+	`
+	res, err := tx.ExecContext(ctx, deleteQuery, userId, requesterId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	followQuery := `
+		INSERT INTO followers(user_id, follower_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := tx.ExecContext(ctx, followQuery, userId, requesterId); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *FollowRequestStore) GetPendingByUserId(ctx context.Context, userId int64) ([]FollowRequest, error) {
+	query := `
+		SELECT fr.user_id, fr.requester_id, fr.created_at, u.id, u.username, u.image_url
+		FROM follow_requests fr
+		JOIN users u
+		ON u.id = fr.requester_id
+		WHERE fr.user_id = $1
+		ORDER BY fr.created_at DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []FollowRequest{}
+	for rows.Next() {
+		var fr FollowRequest
+		err := rows.Scan(
+			&fr.UserID,
+			&fr.RequesterID,
+			&fr.CreatedAt,
+			&fr.Requester.ID,
+			&fr.Requester.Username,
+			&fr.Requester.ImgUrl,
+		)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, fr)
+	}
+
+	return requests, rows.Err()
+}
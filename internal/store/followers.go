@@ -2,7 +2,7 @@ package store
 
 import (
 	"context"
-	"database/sql"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -14,23 +14,34 @@ type Follower struct {
 }
 
 type FollowerStore struct {
-	db *sql.DB
+	db DBTX
 }
 
+// Follow returns ErrBlocked if any of the two users blocked the other
 func (s *FollowerStore) Follow(ctx context.Context, followerId int64, followedId int64) error {
 	query := `
 		INSERT INTO followers(user_id, follower_id)
-		VALUES ($1, $2)
+		SELECT $1, $2
+		WHERE ` + notBlockedClause("$2", "$1") + `
 	`
 
-	_, err := s.db.ExecContext(ctx, query, followedId, followerId)
+	res, err := s.db.ExecContext(ctx, query, followedId, followerId)
 	if err != nil {
 		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
 			return ErrConflict
 		}
+		return err
 	}
 
-	return err
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrBlocked
+	}
+	return nil
 }
 
 func (s *FollowerStore) Unfollow(ctx context.Context, followerId int64, followedId int64) error {
@@ -60,3 +71,145 @@ func (s *FollowerStore) IsFollowed(ctx context.Context, followerId int64, follow
 
 	return isFollowed, nil
 }
+
+// FollowEntry is a user of a followers / following list along with its
+// relationship to the viewer
+type FollowEntry struct {
+	User       User      `json:"user"`
+	FollowedAt time.Time `json:"followed_at"`
+	FollowsYou bool      `json:"follows_you"`
+	YouFollow  bool      `json:"you_follow"`
+	IsMutual   bool      `json:"is_mutual"`
+}
+
+type FollowedBySummary struct {
+	// Users are the first few followers the viewer also follows
+	Users []User `json:"users"`
+	Total int    `json:"total"`
+}
+
+func (s *FollowerStore) GetFollowers(ctx context.Context, userId int64, viewerId int64, cq CursorPaginatedQuery) (CursorPage[FollowEntry], error) {
+	return s.listFollows(ctx, "f.follower_id", "f.user_id", userId, viewerId, cq)
+}
+
+func (s *FollowerStore) GetFollowing(ctx context.Context, userId int64, viewerId int64, cq CursorPaginatedQuery) (CursorPage[FollowEntry], error) {
+	return s.listFollows(ctx, "f.user_id", "f.follower_id", userId, viewerId, cq)
+}
+
+// listFollows lists the users in listedColumn of the follow edges whose ownerColumn is userId
+func (s *FollowerStore) listFollows(ctx context.Context, listedColumn string, ownerColumn string, userId int64, viewerId int64, cq CursorPaginatedQuery) (CursorPage[FollowEntry], error) {
+	cursorTime, cursorId, err := cursorArgs(cq.Cursor)
+	if err != nil {
+		return CursorPage[FollowEntry]{}, err
+	}
+
+	query := `
+		SELECT u.id, u.username, u.image_url, u.bio, f.created_at,
+			EXISTS (SELECT 1 FROM followers x WHERE x.user_id = $2 AND x.follower_id = u.id) AS follows_you,
+			EXISTS (SELECT 1 FROM followers x WHERE x.user_id = u.id AND x.follower_id = $2) AS you_follow
+		FROM followers f
+		JOIN users u
+		ON u.id = ` + listedColumn + `
+		WHERE ` + ownerColumn + ` = $1
+		AND ($3 = '' OR u.username ILIKE '%' || $3 || '%')
+		AND ($4::timestamp with time zone IS NULL OR (f.created_at, u.id) < ($4, $5))
+		AND ` + notBlockedClause("$2", "u.id") + `
+		ORDER BY f.created_at DESC, u.id DESC
+		LIMIT $6
+	`
+
+	// one extra row tells whether there is a next page
+	rows, err := s.db.QueryContext(ctx, query, userId, viewerId, cq.Search, cursorTime, cursorId, cq.Limit+1)
+	if err != nil {
+		return CursorPage[FollowEntry]{}, err
+	}
+	defer rows.Close()
+
+	page := CursorPage[FollowEntry]{Items: []FollowEntry{}}
+	for rows.Next() {
+		var e FollowEntry
+		err := rows.Scan(
+			&e.User.ID,
+			&e.User.Username,
+			&e.User.ImgUrl,
+			&e.User.Bio,
+			&e.FollowedAt,
+			&e.FollowsYou,
+			&e.YouFollow,
+		)
+		if err != nil {
+			return CursorPage[FollowEntry]{}, err
+		}
+		e.IsMutual = e.FollowsYou && e.YouFollow
+		page.Items = append(page.Items, e)
+	}
+	if err := rows.Err(); err != nil {
+		return CursorPage[FollowEntry]{}, err
+	}
+
+	if len(page.Items) > cq.Limit {
+		page.Items = page.Items[:cq.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = EncodeCursor(last.FollowedAt, last.User.ID)
+	}
+
+	return page, nil
+}
+
+// GetFollowedBy summarizes the followers of userId that viewerId follows
+func (s *FollowerStore) GetFollowedBy(ctx context.Context, userId int64, viewerId int64, limit int) (FollowedBySummary, error) {
+	query := `
+		SELECT u.id, u.username, u.image_url, COUNT(*) OVER ()
+		FROM followers f
+		JOIN followers vf
+		ON vf.user_id = f.follower_id AND vf.follower_id = $2
+		JOIN users u
+		ON u.id = f.follower_id
+		WHERE f.user_id = $1
+		ORDER BY vf.created_at DESC
+		LIMIT $3
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userId, viewerId, limit)
+	if err != nil {
+		return FollowedBySummary{}, err
+	}
+	defer rows.Close()
+
+	summary := FollowedBySummary{Users: []User{}}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.ImgUrl, &summary.Total); err != nil {
+			return FollowedBySummary{}, err
+		}
+		summary.Users = append(summary.Users, u)
+	}
+
+	return summary, rows.Err()
+}
+
+// GetFollowingIds returns the ids of every user followed by userId
+func (s *FollowerStore) GetFollowingIds(ctx context.Context, userId int64) ([]int64, error) {
+	query := `
+		SELECT user_id
+		FROM followers
+		WHERE follower_id = $1
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
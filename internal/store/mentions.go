@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type MentionStore struct {
+	db DBTX
+}
+
+// SyncPost makes the post mentions match its entities, it returns the users
+// that weren't mentioned in the post before so only them get notified
+func (s *MentionStore) SyncPost(ctx context.Context, post *Post) ([]User, error) {
+	mentionedIds := post.Entities.MentionedUserIds()
+
+	tx, err := beginTx(ctx, s.db, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	deleteQuery := `
+		DELETE FROM mentions
+		WHERE post_id = $1 AND comment_id IS NULL AND mentioned_user_id <> ALL($2)
+	`
+	if _, err := tx.ExecContext(ctx, deleteQuery, post.ID, pq.Array(mentionedIds)); err != nil {
+		return nil, err
+	}
+
+	// users blocking (or blocked by) the author and users who can't see the
+	// post aren't mentioned
+	insertQuery := `
+		WITH inserted AS (
+			INSERT INTO mentions(post_id, author_id, mentioned_user_id)
+			SELECT p.id, p.user_id, mu.id
+			FROM posts p
+			JOIN users u
+			ON u.id = p.user_id
+			JOIN users mu
+			ON mu.id = ANY($2)
+			WHERE p.id = $1
+			AND mu.id <> p.user_id
+			AND ` + notBlockedClause("mu.id", "p.user_id") + `
+			AND ` + visibleAuthorClause("mu.id") + `
+			AND ` + visiblePostClause("mu.id") + `
+			ON CONFLICT DO NOTHING
+			RETURNING mentioned_user_id
+		)
+		SELECT u.id, u.username, u.email
+		FROM inserted i
+		JOIN users u
+		ON u.id = i.mentioned_user_id
+	`
+	rows, err := tx.QueryContext(ctx, insertQuery, post.ID, pq.Array(mentionedIds))
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := scanMentionedUsers(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return users, tx.Commit()
+}
+
+// CreateForComment records the mentions of a new comment and returns the
+// mentioned users, applying the same rules as SyncPost against both the
+// comment and the post authors
+func (s *MentionStore) CreateForComment(ctx context.Context, comment *Comment) ([]User, error) {
+	mentionedIds := comment.Entities.MentionedUserIds()
+	if len(mentionedIds) == 0 {
+		return []User{}, nil
+	}
+
+	query := `
+		WITH inserted AS (
+			INSERT INTO mentions(post_id, comment_id, author_id, mentioned_user_id)
+			SELECT p.id, $2, $3, mu.id
+			FROM posts p
+			JOIN users u
+			ON u.id = p.user_id
+			JOIN users mu
+			ON mu.id = ANY($4)
+			WHERE p.id = $1
+			AND mu.id <> $3
+			AND ` + notBlockedClause("mu.id", "$3") + `
+			AND ` + notBlockedClause("mu.id", "p.user_id") + `
+			AND ` + visibleAuthorClause("mu.id") + `
+			AND ` + visiblePostClause("mu.id") + `
+			ON CONFLICT DO NOTHING
+			RETURNING mentioned_user_id
+		)
+		SELECT u.id, u.username, u.email
+		FROM inserted i
+		JOIN users u
+		ON u.id = i.mentioned_user_id
+	`
+	rows, err := s.db.QueryContext(ctx, query, comment.PostID, comment.ID, comment.UserID, pq.Array(mentionedIds))
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMentionedUsers(rows)
+}
+
+func scanMentionedUsers(rows *sql.Rows) ([]User, error) {
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// GetMentionedPosts lists the posts the user was mentioned in, either in the
+// post itself or in one of its comments, latest mention first
+func (s *MentionStore) GetMentionedPosts(ctx context.Context, userId int64, pfq PaginatedFeedQuery) ([]PostWithMeta, error) {
+	query := `
+	SELECT p.id, p.content, p.title, p.user_id, p.tags, p.entities, p.visibility, p.status, p.publish_at, p.edited_at IS NOT NULL, p.created_at, p.updated_at, COUNT(c.id), u.username, u.email, u.created_at, u.image_url, u.id,
+		` + viewerPostColumns("$1") + `
+	FROM posts p
+	JOIN (
+		SELECT m.post_id, MAX(m.created_at) AS mentioned_at
+		FROM mentions m
+		WHERE m.mentioned_user_id = $1
+		AND ` + notBlockedClause("$1", "m.author_id") + `
+		GROUP BY m.post_id
+	) lm
+	ON lm.post_id = p.id
+	LEFT JOIN comments c
+	ON c.post_id = p.id
+	LEFT JOIN users u
+	ON p.user_id = u.id
+	WHERE ` + notBlockedClause("$1", "p.user_id") + `
+	AND ` + visibleAuthorClause("$1") + `
+	AND ` + visiblePostClause("$1") + `
+	AND p.status = 'published'
+	AND p.deleted_at IS NULL
+	AND p.hidden_at IS NULL
+	GROUP BY p.id, u.id, lm.mentioned_at
+	ORDER BY lm.mentioned_at DESC, p.id DESC
+	LIMIT $2 OFFSET $3
+`
+	rows, err := s.db.QueryContext(ctx, query, userId, pfq.Limit, pfq.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanPostsWithMeta(rows)
+}
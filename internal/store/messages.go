@@ -0,0 +1,382 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Conversation struct {
+	ID        int64                `json:"id"`
+	IsGroup   bool                 `json:"is_group"`
+	Title     *string              `json:"title"`
+	CreatedBy int64                `json:"created_by"`
+	Members   []ConversationMember `json:"members"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+// ConversationMember carries the read receipt of a member, every message up
+// to LastReadMessageID was read
+type ConversationMember struct {
+	User              User  `json:"user"`
+	LastReadMessageID int64 `json:"last_read_message_id"`
+}
+
+type ConversationSummary struct {
+	Conversation
+	LastMessage *Message `json:"last_message"`
+	UnreadCount int      `json:"unread_count"`
+}
+
+type Message struct {
+	ID             int64     `json:"id"`
+	ConversationID int64     `json:"conversation_id"`
+	SenderID       int64     `json:"sender_id"`
+	Content        string    `json:"content"`
+	CreatedAt      time.Time `json:"created_at"`
+	// ReadBy are the other members who read the message
+	ReadBy []int64 `json:"read_by"`
+}
+
+type MessageStore struct {
+	db DBTX
+}
+
+func directKey(userId int64, otherUserId int64) string {
+	if userId > otherUserId {
+		userId, otherUserId = otherUserId, userId
+	}
+	return strconv.FormatInt(userId, 10) + ":" + strconv.FormatInt(otherUserId, 10)
+}
+
+// CreateConversation creates the conversation between its creator and
+// memberIds. A one-to-one conversation is unique per pair of users, when it
+// already exists ErrConflict is returned with conv.ID set to the existing one
+func (s *MessageStore) CreateConversation(ctx context.Context, conv *Conversation, memberIds []int64) error {
+	var key *string
+	if !conv.IsGroup && len(memberIds) == 1 {
+		k := directKey(conv.CreatedBy, memberIds[0])
+		key = &k
+	}
+
+	tx, err := beginTx(ctx, s.db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO conversations (created_by, is_group, title, direct_key)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (direct_key) DO NOTHING
+		RETURNING id, created_at, updated_at
+	`
+	err = tx.QueryRowContext(ctx, query, conv.CreatedBy, conv.IsGroup, conv.Title, key).Scan(&conv.ID, &conv.CreatedAt, &conv.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		existingQuery := `SELECT id FROM conversations WHERE direct_key = $1`
+		if err := tx.QueryRowContext(ctx, existingQuery, key).Scan(&conv.ID); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	membersQuery := `
+		INSERT INTO conversation_members (conversation_id, user_id)
+		SELECT $1, unnest($2::bigint[])
+	`
+	allMemberIds := append([]int64{conv.CreatedBy}, memberIds...)
+	if _, err := tx.ExecContext(ctx, membersQuery, conv.ID, pq.Array(allMemberIds)); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetConversation returns ErrNotFound if userId isn't a member of the conversation
+func (s *MessageStore) GetConversation(ctx context.Context, conversationId int64, userId int64) (*Conversation, error) {
+	query := `
+		SELECT c.id, c.is_group, c.title, COALESCE(c.created_by, 0), c.created_at, c.updated_at
+		FROM conversations c
+		JOIN conversation_members cm
+		ON cm.conversation_id = c.id AND cm.user_id = $2
+		WHERE c.id = $1
+	`
+
+	var conv Conversation
+	err := s.db.QueryRowContext(ctx, query, conversationId, userId).Scan(
+		&conv.ID,
+		&conv.IsGroup,
+		&conv.Title,
+		&conv.CreatedBy,
+		&conv.CreatedAt,
+		&conv.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	members, err := s.getMembers(ctx, []int64{conv.ID})
+	if err != nil {
+		return nil, err
+	}
+	conv.Members = members[conv.ID]
+
+	return &conv, nil
+}
+
+func (s *MessageStore) getMembers(ctx context.Context, conversationIds []int64) (map[int64][]ConversationMember, error) {
+	query := `
+		SELECT cm.conversation_id, u.id, u.username, u.image_url, cm.last_read_message_id
+		FROM conversation_members cm
+		JOIN users u
+		ON u.id = cm.user_id
+		WHERE cm.conversation_id = ANY($1)
+		ORDER BY cm.joined_at, u.id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(conversationIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := map[int64][]ConversationMember{}
+	for rows.Next() {
+		var conversationId int64
+		var m ConversationMember
+		if err := rows.Scan(&conversationId, &m.User.ID, &m.User.Username, &m.User.ImgUrl, &m.LastReadMessageID); err != nil {
+			return nil, err
+		}
+		members[conversationId] = append(members[conversationId], m)
+	}
+
+	return members, rows.Err()
+}
+
+// GetConversations lists the user conversations by latest activity with their
+// last message and the number of messages the user didn't read yet
+func (s *MessageStore) GetConversations(ctx context.Context, userId int64, cq CursorPaginatedQuery) (CursorPage[ConversationSummary], error) {
+	cursorTime, cursorId, err := cursorArgs(cq.Cursor)
+	if err != nil {
+		return CursorPage[ConversationSummary]{}, err
+	}
+
+	query := `
+		SELECT c.id, c.is_group, c.title, COALESCE(c.created_by, 0), c.created_at, c.updated_at,
+			lm.id, lm.sender_id, lm.content, lm.created_at,
+			(
+				SELECT COUNT(*)
+				FROM messages um
+				WHERE um.conversation_id = c.id AND um.id > cm.last_read_message_id AND um.sender_id <> $1
+				AND ` + notBlockedClause("$1", "um.sender_id") + `
+			)
+		FROM conversation_members cm
+		JOIN conversations c
+		ON c.id = cm.conversation_id
+		LEFT JOIN LATERAL (
+			SELECT m.id, m.sender_id, m.content, m.created_at
+			FROM messages m
+			WHERE m.conversation_id = c.id
+			AND ` + notBlockedClause("$1", "m.sender_id") + `
+			ORDER BY m.created_at DESC, m.id DESC
+			LIMIT 1
+		) lm ON true
+		WHERE cm.user_id = $1
+		AND ($2::timestamp with time zone IS NULL OR (c.updated_at, c.id) < ($2, $3))
+		ORDER BY c.updated_at DESC, c.id DESC
+		LIMIT $4
+	`
+
+	// one extra row tells whether there is a next page
+	rows, err := s.db.QueryContext(ctx, query, userId, cursorTime, cursorId, cq.Limit+1)
+	if err != nil {
+		return CursorPage[ConversationSummary]{}, err
+	}
+	defer rows.Close()
+
+	page := CursorPage[ConversationSummary]{Items: []ConversationSummary{}}
+	for rows.Next() {
+		var c ConversationSummary
+		var lastId, lastSenderId sql.NullInt64
+		var lastContent sql.NullString
+		var lastCreatedAt sql.NullTime
+		err := rows.Scan(
+			&c.ID,
+			&c.IsGroup,
+			&c.Title,
+			&c.CreatedBy,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+			&lastId,
+			&lastSenderId,
+			&lastContent,
+			&lastCreatedAt,
+			&c.UnreadCount,
+		)
+		if err != nil {
+			return CursorPage[ConversationSummary]{}, err
+		}
+		if lastId.Valid {
+			c.LastMessage = &Message{
+				ID:             lastId.Int64,
+				ConversationID: c.ID,
+				SenderID:       lastSenderId.Int64,
+				Content:        lastContent.String,
+				CreatedAt:      lastCreatedAt.Time,
+			}
+		}
+		page.Items = append(page.Items, c)
+	}
+	if err := rows.Err(); err != nil {
+		return CursorPage[ConversationSummary]{}, err
+	}
+
+	if len(page.Items) > cq.Limit {
+		page.Items = page.Items[:cq.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = EncodeCursor(last.UpdatedAt, last.ID)
+	}
+
+	conversationIds := make([]int64, len(page.Items))
+	for i, c := range page.Items {
+		conversationIds[i] = c.ID
+	}
+	members, err := s.getMembers(ctx, conversationIds)
+	if err != nil {
+		return CursorPage[ConversationSummary]{}, err
+	}
+	for i := range page.Items {
+		page.Items[i].Members = members[page.Items[i].ID]
+	}
+
+	return page, nil
+}
+
+// Send stores the message, bumps the conversation activity and marks the
+// message as read by its sender
+func (s *MessageStore) Send(ctx context.Context, msg *Message) error {
+	tx, err := beginTx(ctx, s.db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insertQuery := `
+		INSERT INTO messages (conversation_id, sender_id, content)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+	if err := tx.QueryRowContext(ctx, insertQuery, msg.ConversationID, msg.SenderID, msg.Content).Scan(&msg.ID, &msg.CreatedAt); err != nil {
+		return err
+	}
+
+	activityQuery := `UPDATE conversations SET updated_at = now() WHERE id = $1`
+	if _, err := tx.ExecContext(ctx, activityQuery, msg.ConversationID); err != nil {
+		return err
+	}
+
+	readQuery := `
+		UPDATE conversation_members
+		SET last_read_message_id = $3
+		WHERE conversation_id = $1 AND user_id = $2
+	`
+	if _, err := tx.ExecContext(ctx, readQuery, msg.ConversationID, msg.SenderID, msg.ID); err != nil {
+		return err
+	}
+
+	msg.ReadBy = []int64{}
+	return tx.Commit()
+}
+
+// GetMessages pages the conversation history newest first, hiding the
+// messages of users blocked by or blocking the viewer
+func (s *MessageStore) GetMessages(ctx context.Context, conversationId int64, viewerId int64, cq CursorPaginatedQuery) (CursorPage[Message], error) {
+	cursorTime, cursorId, err := cursorArgs(cq.Cursor)
+	if err != nil {
+		return CursorPage[Message]{}, err
+	}
+
+	query := `
+		SELECT m.id, m.conversation_id, m.sender_id, m.content, m.created_at,
+			ARRAY(
+				SELECT cm.user_id
+				FROM conversation_members cm
+				WHERE cm.conversation_id = m.conversation_id
+				AND cm.user_id <> m.sender_id
+				AND cm.last_read_message_id >= m.id
+				ORDER BY cm.user_id
+			)
+		FROM messages m
+		WHERE m.conversation_id = $1
+		AND ` + notBlockedClause("$2", "m.sender_id") + `
+		AND ($3::timestamp with time zone IS NULL OR (m.created_at, m.id) < ($3, $4))
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT $5
+	`
+
+	// one extra row tells whether there is a next page
+	rows, err := s.db.QueryContext(ctx, query, conversationId, viewerId, cursorTime, cursorId, cq.Limit+1)
+	if err != nil {
+		return CursorPage[Message]{}, err
+	}
+	defer rows.Close()
+
+	page := CursorPage[Message]{Items: []Message{}}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Content, &m.CreatedAt, pq.Array(&m.ReadBy)); err != nil {
+			return CursorPage[Message]{}, err
+		}
+		page.Items = append(page.Items, m)
+	}
+	if err := rows.Err(); err != nil {
+		return CursorPage[Message]{}, err
+	}
+
+	if len(page.Items) > cq.Limit {
+		page.Items = page.Items[:cq.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = EncodeCursor(last.CreatedAt, last.ID)
+	}
+
+	return page, nil
+}
+
+// MarkRead moves the user read receipt up to messageId, or to the latest
+// message when messageId is 0, and returns the resulting receipt
+func (s *MessageStore) MarkRead(ctx context.Context, conversationId int64, userId int64, messageId int64) (int64, error) {
+	query := `
+		WITH latest AS (
+			SELECT COALESCE(MAX(id), 0) AS id FROM messages WHERE conversation_id = $1
+		)
+		UPDATE conversation_members
+		SET last_read_message_id = GREATEST(
+			last_read_message_id,
+			CASE WHEN $3::bigint = 0 THEN (SELECT id FROM latest) ELSE LEAST($3, (SELECT id FROM latest)) END
+		)
+		WHERE conversation_id = $1 AND user_id = $2
+		RETURNING last_read_message_id
+	`
+
+	var lastRead int64
+	err := s.db.QueryRowContext(ctx, query, conversationId, userId, messageId).Scan(&lastRead)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+
+	return lastRead, nil
+}
@@ -0,0 +1,182 @@
+package store
+
+import (
+	"context"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type MuteKind string
+
+const (
+	MuteKindWord MuteKind = "word"
+	MuteKindTag  MuteKind = "tag"
+)
+
+type Mutes struct {
+	Words []string `json:"words"`
+	Tags  []string `json:"tags"`
+	Users []User   `json:"users"`
+}
+
+type MuteStore struct {
+	db DBTX
+}
+
+// NormalizeMuteTerm returns the term as it's stored, it's empty for terms made
+// of whitespace only
+func NormalizeMuteTerm(kind MuteKind, term string) string {
+	if kind == MuteKindTag {
+		return NormalizeTag(term)
+	}
+	return strings.ToLower(strings.TrimSpace(term))
+}
+
+func (s *MuteStore) MuteTerm(ctx context.Context, userId int64, kind MuteKind, term string) error {
+	query := `
+		INSERT INTO muted_terms(user_id, kind, term)
+		VALUES ($1, $2, $3)
+	`
+
+	_, err := s.db.ExecContext(ctx, query, userId, kind, NormalizeMuteTerm(kind, term))
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+	}
+
+	return err
+}
+
+func (s *MuteStore) UnmuteTerm(ctx context.Context, userId int64, kind MuteKind, term string) error {
+	query := `
+		DELETE FROM muted_terms
+		WHERE user_id = $1 AND kind = $2 AND term = $3
+	`
+
+	_, err := s.db.ExecContext(ctx, query, userId, kind, NormalizeMuteTerm(kind, term))
+	return err
+}
+
+func (s *MuteStore) MuteUser(ctx context.Context, userId int64, mutedUserId int64) error {
+	query := `
+		INSERT INTO muted_users(user_id, muted_user_id)
+		VALUES ($1, $2)
+	`
+
+	_, err := s.db.ExecContext(ctx, query, userId, mutedUserId)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+	}
+
+	return err
+}
+
+func (s *MuteStore) UnmuteUser(ctx context.Context, userId int64, mutedUserId int64) error {
+	query := `
+		DELETE FROM muted_users
+		WHERE user_id = $1 AND muted_user_id = $2
+	`
+
+	_, err := s.db.ExecContext(ctx, query, userId, mutedUserId)
+	return err
+}
+
+func (s *MuteStore) GetByUserId(ctx context.Context, userId int64) (Mutes, error) {
+	mutes := Mutes{Words: []string{}, Tags: []string{}, Users: []User{}}
+
+	termsQuery := `
+		SELECT kind, term
+		FROM muted_terms
+		WHERE user_id = $1
+		ORDER BY term
+	`
+	rows, err := s.db.QueryContext(ctx, termsQuery, userId)
+	if err != nil {
+		return Mutes{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind MuteKind
+		var term string
+		if err := rows.Scan(&kind, &term); err != nil {
+			return Mutes{}, err
+		}
+		switch kind {
+		case MuteKindWord:
+			mutes.Words = append(mutes.Words, term)
+		case MuteKindTag:
+			mutes.Tags = append(mutes.Tags, term)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Mutes{}, err
+	}
+
+	usersQuery := `
+		SELECT u.id, u.username, u.image_url
+		FROM muted_users mu
+		JOIN users u
+		ON u.id = mu.muted_user_id
+		WHERE mu.user_id = $1
+		ORDER BY u.username
+	`
+	userRows, err := s.db.QueryContext(ctx, usersQuery, userId)
+	if err != nil {
+		return Mutes{}, err
+	}
+	defer userRows.Close()
+
+	for userRows.Next() {
+		var u User
+		if err := userRows.Scan(&u.ID, &u.Username, &u.ImgUrl); err != nil {
+			return Mutes{}, err
+		}
+		mutes.Users = append(mutes.Users, u)
+	}
+
+	return mutes, userRows.Err()
+}
+
+// mutedPostsClause returns a predicate excluding the posts (aliased p) that the
+// user bound to viewerParam muted by author, tag or word
+func mutedPostsClause(viewerParam string) string {
+	return `NOT EXISTS (
+			SELECT 1 FROM muted_users mu
+			WHERE mu.user_id = ` + viewerParam + ` AND mu.muted_user_id = p.user_id
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM muted_terms mt, unnest(p.tags) AS pt(tag)
+			WHERE mt.user_id = ` + viewerParam + ` AND mt.kind = 'tag' AND lower(pt.tag) = mt.term
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM muted_terms mt
+			WHERE mt.user_id = ` + viewerParam + ` AND mt.kind = 'word'
+			AND (p.content ~* ` + mutedWordPattern("mt.term") + ` OR p.title ~* ` + mutedWordPattern("mt.term") + `)
+		)`
+}
+
+// mutedCommentsClause returns a predicate excluding the comments (aliased c)
+// that the user bound to viewerParam muted by author or word
+func mutedCommentsClause(viewerParam string) string {
+	return `NOT EXISTS (
+			SELECT 1 FROM muted_users mu
+			WHERE mu.user_id = ` + viewerParam + ` AND mu.muted_user_id = c.user_id
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM muted_terms mt
+			WHERE mt.user_id = ` + viewerParam + ` AND mt.kind = 'word'
+			AND c.content ~* ` + mutedWordPattern("mt.term") + `
+		)`
+}
+
+// mutedWordPattern returns a regex matching the word of termColumn as a whole
+// word, so muting "art" doesn't hide "party". The regex special characters of
+// the word are escaped
+func mutedWordPattern(termColumn string) string {
+	return `('\m' || regexp_replace(` + termColumn + `, '([]!$()*+.:<=>?[\\^{|}-])', '\\\1', 'g') || '\M')`
+}
@@ -0,0 +1,192 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type NotificationType string
+
+const (
+	NotificationFollow  NotificationType = "follow"
+	NotificationComment NotificationType = "comment"
+	// NotificationReply is sent to the author of the comment replied to
+	NotificationReply   NotificationType = "reply"
+	NotificationMention NotificationType = "mention"
+)
+
+// notificationActorsPreview is the number of actors listed in a group, the
+// rest are only counted
+const notificationActorsPreview = 3
+
+// Notification groups the activity of the same type on the same post (or on
+// the user for follows) until it's read
+type Notification struct {
+	ID         int64            `json:"id"`
+	Type       NotificationType `json:"type"`
+	PostID     *int64           `json:"post_id"`
+	Actors     []User           `json:"actors"`
+	ActorCount int              `json:"actor_count"`
+	IsRead     bool             `json:"is_read"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+}
+
+type NotificationStore struct {
+	db DBTX
+}
+
+// Create notifies the recipients of the actor activity, skipping the actor
+// itself and recipients who blocked, were blocked by, or muted the actor. It
+// returns the recipients actually notified
+func (s *NotificationStore) Create(ctx context.Context, recipientIds []int64, actorId int64, kind NotificationType, postId *int64) ([]int64, error) {
+	if len(recipientIds) == 0 {
+		return []int64{}, nil
+	}
+
+	query := `
+		INSERT INTO notifications(user_id, type, post_id, actor_ids)
+		SELECT DISTINCT r.id, $2, $3::bigint, ARRAY[$1::bigint]
+		FROM unnest($4::bigint[]) AS r(id)
+		WHERE r.id <> $1
+		AND ` + notBlockedClause("r.id", "$1") + `
+		AND NOT EXISTS (SELECT 1 FROM muted_users mu WHERE mu.user_id = r.id AND mu.muted_user_id = $1)
+		ON CONFLICT (user_id, type, (COALESCE(post_id, 0))) WHERE read_at IS NULL
+		DO UPDATE SET
+			actor_ids = array_prepend($1::bigint, array_remove(notifications.actor_ids, $1::bigint)),
+			updated_at = now()
+		RETURNING user_id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, actorId, kind, postId, pq.Array(recipientIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notified := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		notified = append(notified, id)
+	}
+
+	return notified, rows.Err()
+}
+
+// GetByUserId pages the notifications by their latest activity, a group
+// getting new activity moves back to the first page
+func (s *NotificationStore) GetByUserId(ctx context.Context, userId int64, cq CursorPaginatedQuery) (CursorPage[Notification], error) {
+	cursorTime, cursorId, err := cursorArgs(cq.Cursor)
+	if err != nil {
+		return CursorPage[Notification]{}, err
+	}
+
+	query := `
+		SELECT n.id, n.type, n.post_id, cardinality(n.actor_ids), n.read_at IS NOT NULL, n.created_at, n.updated_at,
+			COALESCE((
+				SELECT json_agg(json_build_object('id', u.id, 'username', u.username, 'img_url', u.image_url) ORDER BY a.ord)
+				FROM unnest(n.actor_ids[1:$5]) WITH ORDINALITY AS a(id, ord)
+				JOIN users u
+				ON u.id = a.id
+			), '[]')
+		FROM notifications n
+		WHERE n.user_id = $1
+		AND ($2::timestamp with time zone IS NULL OR (n.updated_at, n.id) < ($2, $3))
+		ORDER BY n.updated_at DESC, n.id DESC
+		LIMIT $4
+	`
+
+	// one extra row tells whether there is a next page
+	rows, err := s.db.QueryContext(ctx, query, userId, cursorTime, cursorId, cq.Limit+1, notificationActorsPreview)
+	if err != nil {
+		return CursorPage[Notification]{}, err
+	}
+	defer rows.Close()
+
+	page := CursorPage[Notification]{Items: []Notification{}}
+	for rows.Next() {
+		var n Notification
+		var actors []byte
+		err := rows.Scan(
+			&n.ID,
+			&n.Type,
+			&n.PostID,
+			&n.ActorCount,
+			&n.IsRead,
+			&n.CreatedAt,
+			&n.UpdatedAt,
+			&actors,
+		)
+		if err != nil {
+			return CursorPage[Notification]{}, err
+		}
+		if err := json.Unmarshal(actors, &n.Actors); err != nil {
+			return CursorPage[Notification]{}, err
+		}
+		page.Items = append(page.Items, n)
+	}
+	if err := rows.Err(); err != nil {
+		return CursorPage[Notification]{}, err
+	}
+
+	if len(page.Items) > cq.Limit {
+		page.Items = page.Items[:cq.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = EncodeCursor(last.UpdatedAt, last.ID)
+	}
+
+	return page, nil
+}
+
+func (s *NotificationStore) MarkRead(ctx context.Context, userId int64, notificationId int64) error {
+	query := `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, now())
+		WHERE id = $1 AND user_id = $2
+	`
+
+	res, err := s.db.ExecContext(ctx, query, notificationId, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *NotificationStore) MarkAllRead(ctx context.Context, userId int64) error {
+	query := `
+		UPDATE notifications
+		SET read_at = now()
+		WHERE user_id = $1 AND read_at IS NULL
+	`
+
+	_, err := s.db.ExecContext(ctx, query, userId)
+	return err
+}
+
+func (s *NotificationStore) GetUnreadCount(ctx context.Context, userId int64) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM notifications
+		WHERE user_id = $1 AND read_at IS NULL
+	`
+
+	var count int
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(&count)
+	return count, err
+}
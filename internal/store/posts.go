@@ -4,38 +4,76 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"slices"
+	"time"
 
 	"github.com/lib/pq"
+	"github.com/shehab910/social/internal/entities"
 	"github.com/shehab910/social/internal/utils"
 )
 
+const (
+	// VisibilityPublic posts are visible to everyone and listed in explore
+	VisibilityPublic = "public"
+	// VisibilityFollowers posts are only visible to the author's followers
+	VisibilityFollowers = "followers"
+	// VisibilityUnlisted posts are visible to everyone but not listed in explore
+	VisibilityUnlisted = "unlisted"
+	// VisibilityPrivate posts are only visible to their author
+	VisibilityPrivate = "private"
+)
+
+const (
+	StatusDraft     = "draft"
+	StatusScheduled = "scheduled"
+	StatusPublished = "published"
+)
+
 type Post struct {
-	ID        int64     `json:"id"`
-	Content   string    `json:"content"`
-	Title     string    `json:"title"`
-	UserID    int64     `json:"user_id"`
-	Tags      []string  `json:"tags"`
-	CreatedAt string    `json:"created_at"`
-	UpdatedAt string    `json:"updated_at"`
-	Comments  []Comment `json:"comments"`
-	User      User      `json:"user,omitempty"`
+	ID         int64         `json:"id"`
+	Content    string        `json:"content"`
+	Title      string        `json:"title"`
+	UserID     int64         `json:"user_id"`
+	Tags       []string      `json:"tags"`
+	Entities   entities.List `json:"entities"`
+	Visibility string        `json:"visibility"`
+	Status     string        `json:"status"`
+	PublishAt  *string       `json:"publish_at,omitempty"`
+	Edited     bool          `json:"edited"`
+	Hidden     bool          `json:"hidden,omitempty"` // taken down by moderation, only the author sees it
+	DeletedAt  *string       `json:"deleted_at,omitempty"`
+	CreatedAt  string        `json:"created_at"`
+	UpdatedAt  string        `json:"updated_at"`
+	Comments   []Comment     `json:"comments"`
+	User       User          `json:"user,omitempty"`
 }
 
 type PostWithMeta struct {
 	Post
 	CommentCount int `json:"comments_count"`
+	// viewer dependent fields, all false for anonymous viewers
+	IsOwner           bool `json:"is_owner"`
+	IsFollowingAuthor bool `json:"is_following_author"`
+	HasCommented      bool `json:"has_commented"`
 }
 
 type PostStore struct {
-	db *sql.DB
+	db DBTX
 }
 
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
 	query := `
-		INSERT INTO posts (content, title, user_id, tags)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO posts (content, title, user_id, tags, visibility, status, publish_at, entities)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id, created_at, updated_at
 	`
+	if post.Visibility == "" {
+		post.Visibility = VisibilityPublic
+	}
+	if post.Status == "" {
+		post.Status = StatusPublished
+	}
+
 	return s.db.QueryRowContext(
 		ctx,
 		query,
@@ -43,6 +81,10 @@ func (s *PostStore) Create(ctx context.Context, post *Post) error {
 		post.Title,
 		post.UserID,
 		pq.Array(post.Tags),
+		post.Visibility,
+		post.Status,
+		post.PublishAt,
+		post.Entities,
 	).Scan(
 		&post.ID,
 		&post.CreatedAt,
@@ -52,11 +94,11 @@ func (s *PostStore) Create(ctx context.Context, post *Post) error {
 
 func (s *PostStore) GetByIdWithUser(ctx context.Context, id int64) (*Post, error) {
 	query := `
-		SELECT p.id, p.title, p.content, p.user_id, p.created_at, p.updated_at, p.tags, p.user_id, u.username, u.email
+		SELECT p.id, p.title, p.content, p.user_id, p.created_at, p.updated_at, p.tags, p.entities, p.visibility, p.status, p.publish_at, p.edited_at IS NOT NULL, p.hidden_at IS NOT NULL, p.user_id, u.username, u.email, u.is_private
 		FROM posts p
 		JOIN users u
 		ON p.user_id = u.id
-		WHERE p.id = $1
+		WHERE p.id = $1 AND p.deleted_at IS NULL
 	`
 	var post Post
 	err := s.db.QueryRowContext(ctx, query, id).Scan(
@@ -67,9 +109,16 @@ func (s *PostStore) GetByIdWithUser(ctx context.Context, id int64) (*Post, error
 		&post.CreatedAt,
 		&post.UpdatedAt,
 		pq.Array(&post.Tags),
+		&post.Entities,
+		&post.Visibility,
+		&post.Status,
+		&post.PublishAt,
+		&post.Edited,
+		&post.Hidden,
 		&post.User.ID,
 		&post.User.Username,
 		&post.User.Email,
+		&post.User.IsPrivate,
 	)
 
 	if err != nil {
@@ -84,8 +133,45 @@ func (s *PostStore) GetByIdWithUser(ctx context.Context, id int64) (*Post, error
 	return &post, nil
 }
 
+func (s *PostStore) GetByIdWithMeta(ctx context.Context, id int64, viewerId int64) (*PostWithMeta, error) {
+	query := `
+		SELECT p.id, p.content, p.title, p.user_id, p.tags, p.entities, p.visibility, p.status, p.publish_at, p.edited_at IS NOT NULL, p.created_at, p.updated_at, COUNT(c.id), u.username, u.email, u.created_at, u.image_url, u.id,
+			` + viewerPostColumns("$2") + `
+		FROM posts p
+		LEFT JOIN comments c
+		ON c.post_id = p.id
+		LEFT JOIN users u
+		ON p.user_id = u.id
+		WHERE p.id = $1 AND p.deleted_at IS NULL
+		AND (p.hidden_at IS NULL OR p.user_id = $2)
+		GROUP BY p.id, u.id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, id, viewerId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts, err := scanPostsWithMeta(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(posts) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &posts[0], nil
+}
+
+// DeleteById moves the post to the trash, see Restore and PurgeDeleted
 func (s *PostStore) DeleteById(ctx context.Context, postID int64) error {
-	query := `DELETE FROM posts WHERE id = $1`
+	query := `
+		UPDATE posts
+		SET deleted_at = now()
+		WHERE id = $1 AND deleted_at IS NULL
+	`
 	res, err := s.db.ExecContext(ctx, query, postID)
 	if err != nil {
 		return err
@@ -102,96 +188,227 @@ func (s *PostStore) DeleteById(ctx context.Context, postID int64) error {
 	return nil
 }
 
+// Update appends a revision whenever the title, content or tags change, the
+// first edit also records the original version as revision 1
 func (s *PostStore) Update(ctx context.Context, post *Post) error {
+	tx, err := beginTx(ctx, s.db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current Post
+	currentQuery := `
+		SELECT title, content, tags, created_at
+		FROM posts
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+	err = tx.QueryRowContext(ctx, currentQuery, post.ID).Scan(
+		&current.Title,
+		&current.Content,
+		pq.Array(&current.Tags),
+		&current.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	isEdited := current.Title != post.Title || current.Content != post.Content || !slices.Equal(current.Tags, post.Tags)
+	if isEdited {
+		firstRevisionQuery := `
+			INSERT INTO post_revisions (post_id, revision, title, content, tags, created_at)
+			SELECT $1, 1, $2, $3, $4, $5
+			WHERE NOT EXISTS (SELECT 1 FROM post_revisions WHERE post_id = $1)
+		`
+		_, err := tx.ExecContext(ctx, firstRevisionQuery, post.ID, current.Title, current.Content, pq.Array(current.Tags), current.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		revisionQuery := `
+			INSERT INTO post_revisions (post_id, revision, title, content, tags)
+			SELECT $1, MAX(revision) + 1, $2, $3, $4
+			FROM post_revisions
+			WHERE post_id = $1
+		`
+		_, err = tx.ExecContext(ctx, revisionQuery, post.ID, post.Title, post.Content, pq.Array(post.Tags))
+		if err != nil {
+			return err
+		}
+	}
+
 	query := `
 		UPDATE posts
-		SET title = $1, content = $2
-		WHERE id = $3
+		SET title = $1,
+			content = $2,
+			tags = $3,
+			visibility = $4,
+			entities = $5,
+			updated_at = now(),
+			edited_at = CASE WHEN $6 THEN now() ELSE edited_at END
+		WHERE id = $7
+		RETURNING updated_at, edited_at IS NOT NULL
 	`
+	err = tx.QueryRowContext(
+		ctx,
+		query,
+		post.Title,
+		post.Content,
+		pq.Array(post.Tags),
+		post.Visibility,
+		post.Entities,
+		isEdited,
+		post.ID,
+	).Scan(&post.UpdatedAt, &post.Edited)
+	if err != nil {
+		return err
+	}
 
-	_, err := s.db.ExecContext(ctx, query, post.Title, post.Content, post.ID)
+	return tx.Commit()
+}
+
+type PostRevision struct {
+	PostID    int64    `json:"post_id"`
+	Revision  int      `json:"revision"`
+	Title     string   `json:"title"`
+	Content   string   `json:"content"`
+	Tags      []string `json:"tags"`
+	CreatedAt string   `json:"created_at"`
+}
 
+// GetRevisions returns the revisions of a post from the oldest to the latest
+func (s *PostStore) GetRevisions(ctx context.Context, postId int64) ([]PostRevision, error) {
+	query := `
+		SELECT post_id, revision, title, content, tags, created_at
+		FROM post_revisions
+		WHERE post_id = $1
+		ORDER BY revision
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, postId)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var rev PostRevision
+		err := rows.Scan(&rev.PostID, &rev.Revision, &rev.Title, &rev.Content, pq.Array(&rev.Tags), &rev.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
 }
 
-// pfq.Sort must be validated / sanitized before calling this function
-func (s *PostStore) GetUserFeed(ctx context.Context, userId int64, pfq PaginatedFeedQuery) ([]PostWithMeta, error) {
+func (s *PostStore) GetRevision(ctx context.Context, postId int64, revision int) (*PostRevision, error) {
 	query := `
-		SELECT p.id, p.content, p.title, p.user_id, p.tags, p.created_at, p.updated_at, COUNT(c.id), u.username, u.email, u.created_at, u.image_url, u.id
-		FROM posts p
+		SELECT post_id, revision, title, content, tags, created_at
+		FROM post_revisions
+		WHERE post_id = $1 AND revision = $2
+	`
+
+	var rev PostRevision
+	err := s.db.QueryRowContext(ctx, query, postId, revision).Scan(
+		&rev.PostID,
+		&rev.Revision,
+		&rev.Title,
+		&rev.Content,
+		pq.Array(&rev.Tags),
+		&rev.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &rev, nil
+}
+
+// GetUserFeed pages the feed of userId newest first, opts picks its sources
+// (see feedMembershipClause)
+func (s *PostStore) GetUserFeed(ctx context.Context, userId int64, fq CursorFeedQuery, opts FeedOptions) (CursorPage[PostWithMeta], error) {
+	cursorTime, cursorId, err := cursorArgs(fq.Cursor)
+	if err != nil {
+		return CursorPage[PostWithMeta]{}, err
+	}
+
+	query := `
+		WITH feed AS (
+		` + feedMembershipClause(opts) + `
+		)
+		SELECT p.id, p.content, p.title, p.user_id, p.tags, p.entities, p.visibility, p.status, p.publish_at, p.edited_at IS NOT NULL, p.created_at, p.updated_at, COUNT(c.id), u.username, u.email, u.created_at, u.image_url, u.id,
+			` + viewerPostColumns("$1") + `
+		FROM feed
+		JOIN posts p
+		ON p.id = feed.id
 		LEFT JOIN comments c
 		ON c.post_id = p.id
 		LEFT JOIN users u
 		ON p.user_id = u.id
-		JOIN followers f 
-		ON f.user_id = p.user_id OR p.user_id = $1
-		WHERE f.follower_id = $1
-		AND ($2 = '{}' OR EXISTS (
-			SELECT 1 
-			FROM unnest($2::text[]) AS search_tag 
-			WHERE p.tags::text ILIKE '%' || search_tag || '%'
-		))
-		AND ($3 = '' OR p.content ILIKE '%' || $3 || '%' OR p.title ILIKE '%' || $3 || '%')
-		AND ($4 = '' OR p.created_at >= $4::timestamp with time zone)
-		AND ($5 = '' OR p.created_at <= $5::timestamp with time zone)
-		GROUP BY p.id, u.id
-		ORDER BY p.created_at ` + pfq.Sort + `
-		LIMIT $6
-		OFFSET $7
+		GROUP BY p.id, u.id, feed.created_at
+		ORDER BY feed.created_at DESC, p.id DESC
+		LIMIT $4
 	`
-	var postsWithMeta []PostWithMeta
 
+	// one extra row tells whether there is a next page
 	rows, err := s.db.QueryContext(
 		ctx,
 		query,
 		userId,
-		pq.Array(pfq.Tags),
-		pfq.Search,
-		parseDbTime(pfq.Since),
-		parseDbTime(pfq.Until),
-		pfq.Limit,
-		pfq.Offset,
+		cursorTime,
+		cursorId,
+		fq.Limit+1,
+		pq.Array(fq.Tags),
+		fq.Search,
+		parseDbTime(fq.Since),
+		parseDbTime(fq.Until),
+		CelebrityFollowerThreshold,
 	)
 	if err != nil {
-		return nil, err
+		return CursorPage[PostWithMeta]{}, err
 	}
 	defer rows.Close()
 
-	for rows.Next() {
-		var p PostWithMeta
+	posts, err := scanPostsWithMeta(rows)
+	if err != nil {
+		return CursorPage[PostWithMeta]{}, err
+	}
 
-		err := rows.Scan(
-			&p.ID,
-			&p.Content,
-			&p.Title,
-			&p.UserID,
-			pq.Array(&p.Tags),
-			&p.CreatedAt,
-			&p.UpdatedAt,
-			&p.CommentCount,
-			&p.User.Username,
-			&p.User.Email,
-			&p.User.CreatedAt,
-			&p.User.ImgUrl,
-			&p.User.ID,
-		)
+	page := CursorPage[PostWithMeta]{Items: posts}
+	if page.Items == nil {
+		page.Items = []PostWithMeta{}
+	}
+
+	if len(page.Items) > fq.Limit {
+		page.Items = page.Items[:fq.Limit]
+		last := page.Items[len(page.Items)-1]
+		// the timeline keeps the created_at of the post, so it's the sort time of every source
+		lastCreatedAt, err := time.Parse(time.RFC3339Nano, last.CreatedAt)
 		if err != nil {
-			return nil, err
+			return CursorPage[PostWithMeta]{}, err
 		}
-		postsWithMeta = append(postsWithMeta, p)
+		page.NextCursor = EncodeCursor(lastCreatedAt, last.ID)
 	}
 
-	return postsWithMeta, nil
+	return page, nil
 }
 
 // pfq.Sort must be validated / sanitized before calling this function
-func (s *PostStore) GetExploreFeed(ctx context.Context, pfq PaginatedFeedQuery) ([]PostWithMeta, error) {
+// viewerId is 0 for anonymous viewers
+func (s *PostStore) GetExploreFeed(ctx context.Context, pfq PaginatedFeedQuery, viewerId int64, opts FeedOptions) ([]PostWithMeta, error) {
 	query := `
-		SELECT p.id, p.content, p.title, p.user_id, p.tags, p.created_at, p.updated_at, COUNT(c.id), u.username, u.email, u.created_at, u.image_url, u.id
+		SELECT p.id, p.content, p.title, p.user_id, p.tags, p.entities, p.visibility, p.status, p.publish_at, p.edited_at IS NOT NULL, p.created_at, p.updated_at, COUNT(c.id), u.username, u.email, u.created_at, u.image_url, u.id,
+			` + viewerPostColumns("$7") + `
 		FROM posts p
 		LEFT JOIN comments c
 		ON c.post_id = p.id
@@ -205,13 +422,19 @@ func (s *PostStore) GetExploreFeed(ctx context.Context, pfq PaginatedFeedQuery)
 		AND ($2 = '' OR p.content ILIKE '%' || $2 || '%' OR p.title ILIKE '%' || $2 || '%')
 		AND ($3 = '' OR p.created_at >= $3::timestamp with time zone)
 		AND ($4 = '' OR p.created_at <= $4::timestamp with time zone)
+		AND ` + mutedPostsClause("$7") + `
+		AND ` + notBlockedClause("$7", "p.user_id") + `
+		AND ` + visibleAuthorClause("$7") + `
+		AND ` + activeAuthorClause(opts.HideSuspendedAuthors) + `
+		AND p.visibility = 'public'
+		AND p.status = 'published'
+		AND p.deleted_at IS NULL
+		AND p.hidden_at IS NULL
 		GROUP BY p.id, u.id
 		ORDER BY p.created_at ` + pfq.Sort + `
 		LIMIT $5
 		OFFSET $6
 	`
-	var postsWithMeta []PostWithMeta
-
 	rows, err := s.db.QueryContext(
 		ctx,
 		query,
@@ -221,63 +444,60 @@ func (s *PostStore) GetExploreFeed(ctx context.Context, pfq PaginatedFeedQuery)
 		parseDbTime(pfq.Until),
 		pfq.Limit,
 		pfq.Offset,
+		viewerId,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	for rows.Next() {
-		var p PostWithMeta
-
-		err := rows.Scan(
-			&p.ID,
-			&p.Content,
-			&p.Title,
-			&p.UserID,
-			pq.Array(&p.Tags),
-			&p.CreatedAt,
-			&p.UpdatedAt,
-			&p.CommentCount,
-			&p.User.Username,
-			&p.User.Email,
-			&p.User.CreatedAt,
-			&p.User.ImgUrl,
-			&p.User.ID,
-		)
-		if err != nil {
-			return nil, err
-		}
-		postsWithMeta = append(postsWithMeta, p)
-	}
-
-	return postsWithMeta, nil
+	return scanPostsWithMeta(rows)
 }
 
-func (s *PostStore) GetUserPostsByUserId(ctx context.Context, userId int64) ([]PostWithMeta, error) {
+// posts are hidden if the viewer and the user blocked each other
+func (s *PostStore) GetUserPostsByUserId(ctx context.Context, userId int64, viewerId int64) ([]PostWithMeta, error) {
 	query := `
-	SELECT p.id, p.content, p.title, p.user_id, p.tags, p.created_at, p.updated_at, COUNT(c.id), u.username, u.email, u.created_at, u.image_url, u.id
+	SELECT p.id, p.content, p.title, p.user_id, p.tags, p.entities, p.visibility, p.status, p.publish_at, p.edited_at IS NOT NULL, p.created_at, p.updated_at, COUNT(c.id), u.username, u.email, u.created_at, u.image_url, u.id,
+		` + viewerPostColumns("$2") + `
 	FROM posts p
 	LEFT JOIN comments c
 	ON c.post_id = p.id
 	LEFT JOIN users u
 	ON p.user_id = u.id
 	WHERE p.user_id = $1
+	AND ` + notBlockedClause("$2", "p.user_id") + `
+	AND ` + visiblePostClause("$2") + `
+	AND p.status = 'published'
+	AND p.deleted_at IS NULL
+	AND (p.hidden_at IS NULL OR p.user_id = $2)
 	GROUP BY p.id, u.id
 	ORDER BY p.created_at DESC
 `
-	var postsWithMeta []PostWithMeta
-
 	rows, err := s.db.QueryContext(
 		ctx,
 		query,
 		userId,
+		viewerId,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	return scanPostsWithMeta(rows)
+}
+
+// viewerPostColumns selects the PostWithMeta fields depending on the user
+// bound to viewerParam (0 for anonymous viewers)
+func viewerPostColumns(viewerParam string) string {
+	return `p.user_id = ` + viewerParam + ` AS is_owner,
+			EXISTS (SELECT 1 FROM followers vaf WHERE vaf.user_id = p.user_id AND vaf.follower_id = ` + viewerParam + `) AS is_following_author,
+			EXISTS (SELECT 1 FROM comments vc WHERE vc.post_id = p.id AND vc.user_id = ` + viewerParam + `) AS has_commented`
+}
+
+func scanPostsWithMeta(rows *sql.Rows) ([]PostWithMeta, error) {
+	var postsWithMeta []PostWithMeta
+
 	for rows.Next() {
 		var p PostWithMeta
 
@@ -287,6 +507,11 @@ func (s *PostStore) GetUserPostsByUserId(ctx context.Context, userId int64) ([]P
 			&p.Title,
 			&p.UserID,
 			pq.Array(&p.Tags),
+			&p.Entities,
+			&p.Visibility,
+			&p.Status,
+			&p.PublishAt,
+			&p.Edited,
 			&p.CreatedAt,
 			&p.UpdatedAt,
 			&p.CommentCount,
@@ -295,6 +520,9 @@ func (s *PostStore) GetUserPostsByUserId(ctx context.Context, userId int64) ([]P
 			&p.User.CreatedAt,
 			&p.User.ImgUrl,
 			&p.User.ID,
+			&p.IsOwner,
+			&p.IsFollowingAuthor,
+			&p.HasCommented,
 		)
 		if err != nil {
 			return nil, err
@@ -302,7 +530,7 @@ func (s *PostStore) GetUserPostsByUserId(ctx context.Context, userId int64) ([]P
 		postsWithMeta = append(postsWithMeta, p)
 	}
 
-	return postsWithMeta, nil
+	return postsWithMeta, rows.Err()
 }
 
 func parseDbTime(t string) []byte {
@@ -315,3 +543,222 @@ func parseDbTime(t string) []byte {
 	}
 	return pq.FormatTimestamp(parsedT)
 }
+
+// GetUnpublishedByUserId returns the drafts and scheduled posts of a user
+func (s *PostStore) GetUnpublishedByUserId(ctx context.Context, userId int64) ([]Post, error) {
+	query := `
+		SELECT id, title, content, user_id, tags, visibility, status, publish_at, created_at, updated_at
+		FROM posts
+		WHERE user_id = $1 AND status <> 'published' AND deleted_at IS NULL
+		ORDER BY COALESCE(publish_at, updated_at) DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.Title,
+			&p.Content,
+			&p.UserID,
+			pq.Array(&p.Tags),
+			&p.Visibility,
+			&p.Status,
+			&p.PublishAt,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
+// Schedule turns a draft into a scheduled post, a nil publishAt moves it back to drafts
+func (s *PostStore) Schedule(ctx context.Context, post *Post, publishAt *string) error {
+	query := `
+		UPDATE posts
+		SET status = $1, publish_at = $2, updated_at = now()
+		WHERE id = $3 AND status <> 'published' AND deleted_at IS NULL
+		RETURNING status, publish_at, updated_at
+	`
+
+	status := StatusDraft
+	if publishAt != nil {
+		status = StatusScheduled
+	}
+
+	err := s.db.QueryRowContext(ctx, query, status, publishAt, post.ID).Scan(&post.Status, &post.PublishAt, &post.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Publish publishes a draft or scheduled post right away, created_at is reset
+// so the post shows up at the top of the feeds
+func (s *PostStore) Publish(ctx context.Context, post *Post) error {
+	query := `
+		UPDATE posts
+		SET status = 'published', publish_at = NULL, created_at = now(), updated_at = now()
+		WHERE id = $1 AND status <> 'published' AND deleted_at IS NULL
+		RETURNING status, created_at, updated_at
+	`
+
+	err := s.db.QueryRowContext(ctx, query, post.ID).Scan(&post.Status, &post.CreatedAt, &post.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	post.PublishAt = nil
+	return nil
+}
+
+// PublishDue publishes up to limit scheduled posts whose publish_at is due.
+// Rows locked by another replica are skipped and the status transition is
+// atomic, so every post is returned to exactly one caller.
+func (s *PostStore) PublishDue(ctx context.Context, limit int) ([]Post, error) {
+	query := `
+		UPDATE posts
+		SET status = 'published', created_at = publish_at, publish_at = NULL, updated_at = now()
+		WHERE id IN (
+			SELECT id
+			FROM posts
+			WHERE status = 'scheduled' AND publish_at <= now() AND deleted_at IS NULL
+			ORDER BY publish_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, title, content, user_id, tags, entities, visibility, status, created_at, updated_at
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.Title,
+			&p.Content,
+			&p.UserID,
+			pq.Array(&p.Tags),
+			&p.Entities,
+			&p.Visibility,
+			&p.Status,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
+// GetTrashByUserId returns the deleted posts of a user that can still be restored
+func (s *PostStore) GetTrashByUserId(ctx context.Context, userId int64, retention time.Duration) ([]Post, error) {
+	query := `
+		SELECT id, title, content, user_id, tags, visibility, status, created_at, updated_at, deleted_at
+		FROM posts
+		WHERE user_id = $1
+		AND deleted_at IS NOT NULL
+		AND deleted_at > now() - make_interval(secs => $2)
+		ORDER BY deleted_at DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userId, retention.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var p Post
+		err := rows.Scan(
+			&p.ID,
+			&p.Title,
+			&p.Content,
+			&p.UserID,
+			pq.Array(&p.Tags),
+			&p.Visibility,
+			&p.Status,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+			&p.DeletedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+
+	return posts, rows.Err()
+}
+
+// Restore takes a post of userId out of the trash if it was deleted within the retention window
+func (s *PostStore) Restore(ctx context.Context, postId int64, userId int64, retention time.Duration) error {
+	query := `
+		UPDATE posts
+		SET deleted_at = NULL
+		WHERE id = $1
+		AND user_id = $2
+		AND deleted_at IS NOT NULL
+		AND deleted_at > now() - make_interval(secs => $3)
+	`
+
+	res, err := s.db.ExecContext(ctx, query, postId, userId, retention.Seconds())
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// PurgeDeleted permanently removes the posts deleted before the retention
+// window, their comments, revisions and timeline entries cascade
+func (s *PostStore) PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error) {
+	query := `
+		DELETE FROM posts
+		WHERE deleted_at IS NOT NULL
+		AND deleted_at <= now() - make_interval(secs => $1)
+	`
+
+	res, err := s.db.ExecContext(ctx, query, retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
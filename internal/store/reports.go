@@ -0,0 +1,447 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ReportTargetPost    = "post"
+	ReportTargetComment = "comment"
+	ReportTargetUser    = "user"
+)
+
+// ReportReasonScreening is used by the screening pipeline for flagged content
+const ReportReasonScreening = "screening"
+
+const (
+	ReportStatusOpen      = "open"
+	ReportStatusClaimed   = "claimed"
+	ReportStatusResolved  = "resolved"
+	ReportStatusDismissed = "dismissed"
+)
+
+const (
+	// ModerationRemoveContent hides the reported post or comment for good
+	ModerationRemoveContent = "remove_content"
+	ModerationWarn          = "warn"
+	ModerationSuspendUser   = "suspend_user"
+	// ModerationDismiss closes the reports and unhides auto-hidden content
+	ModerationDismiss = "dismiss"
+)
+
+// Why a post or comment is hidden, only the content hidden by reports comes
+// back when they're dismissed
+const (
+	hiddenByReports   = "reports"
+	hiddenByModerator = "moderator"
+)
+
+var ErrInvalidModerationAction = errors.New("action doesn't apply to this target")
+
+type Report struct {
+	ID         int64      `json:"id"`
+	ReporterID *int64     `json:"reporter_id"` // nil for the reports filed by the screening pipeline
+	TargetType string     `json:"target_type"`
+	TargetID   int64      `json:"target_id"`
+	Reason     string     `json:"reason"`
+	Details    *string    `json:"details"`
+	Status     string     `json:"status"`
+	ClaimedBy  *int64     `json:"claimed_by"`
+	ClaimedAt  *time.Time `json:"claimed_at"`
+	ResolvedBy *int64     `json:"resolved_by"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	Resolution *string    `json:"resolution"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// TargetReports is the number of reports on the same target
+	TargetReports int `json:"target_reports"`
+}
+
+type ReportFilter struct {
+	Status     string `json:"status" validate:"omitempty,oneof=open claimed resolved dismissed"`
+	TargetType string `json:"target_type" validate:"omitempty,oneof=post comment user"`
+}
+
+type Resolution struct {
+	Action string
+	Note   *string
+	// SuspendedUntil is required by ModerationSuspendUser
+	SuspendedUntil *time.Time
+}
+
+type ModerationAction struct {
+	ID           int64     `json:"id"`
+	ModeratorID  *int64    `json:"moderator_id"`
+	ReportID     *int64    `json:"report_id"`
+	Action       string    `json:"action"`
+	TargetType   string    `json:"target_type"`
+	TargetID     int64     `json:"target_id"`
+	TargetUserID *int64    `json:"target_user_id"`
+	Note         *string   `json:"note"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type ReportStore struct {
+	db DBTX
+}
+
+// targetOwnerQuery selects the author of the target, $1 is the type and $2 the id
+const targetOwnerQuery = `
+	SELECT user_id FROM posts WHERE $1 = 'post' AND id = $2 AND deleted_at IS NULL
+	UNION ALL
+	SELECT user_id FROM comments WHERE $1 = 'comment' AND id = $2
+	UNION ALL
+	SELECT id FROM users WHERE $1 = 'user' AND id = $2
+`
+
+// GetTargetOwnerId returns the author of a post or comment, or the user itself
+func (s *ReportStore) GetTargetOwnerId(ctx context.Context, targetType string, targetId int64) (int64, error) {
+	var ownerId int64
+	err := s.db.QueryRowContext(ctx, targetOwnerQuery, targetType, targetId).Scan(&ownerId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+
+	return ownerId, nil
+}
+
+// Create files the report and hides the reported post or comment once it has
+// autoHideThreshold pending reports from users, a user reports a target once
+// so it counts independent reports. The screening reports have no reporter
+// and aren't deduplicated, they never count. It returns whether the content
+// got hidden
+func (s *ReportStore) Create(ctx context.Context, report *Report, autoHideThreshold int) (bool, error) {
+	tx, err := beginTx(ctx, s.db, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	insertQuery := `
+		INSERT INTO reports (reporter_id, target_type, target_id, reason, details)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, status, created_at
+	`
+	err = tx.QueryRowContext(
+		ctx,
+		insertQuery,
+		report.ReporterID,
+		report.TargetType,
+		report.TargetID,
+		report.Reason,
+		report.Details,
+	).Scan(&report.ID, &report.Status, &report.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return false, ErrConflict
+		}
+		return false, err
+	}
+
+	countQuery := `
+		SELECT COUNT(*)
+		FROM reports
+		WHERE target_type = $1 AND target_id = $2 AND status IN ('open', 'claimed') AND reporter_id IS NOT NULL
+	`
+	if err := tx.QueryRowContext(ctx, countQuery, report.TargetType, report.TargetID).Scan(&report.TargetReports); err != nil {
+		return false, err
+	}
+
+	hidden := false
+	if autoHideThreshold > 0 && report.TargetReports >= autoHideThreshold && report.TargetType != ReportTargetUser {
+		if err := hideContent(ctx, tx, report.TargetType, report.TargetID, hiddenByReports); err != nil {
+			return false, err
+		}
+		hidden = true
+	}
+
+	return hidden, tx.Commit()
+}
+
+func hiddenContentTable(targetType string) string {
+	if targetType == ReportTargetComment {
+		return "comments"
+	}
+	return "posts"
+}
+
+// hideContent hides the post or comment for reason, a removal by a moderator
+// is never downgraded to an auto-hide
+func hideContent(ctx context.Context, tx DBTX, targetType string, targetId int64, reason string) error {
+	query := `
+		UPDATE ` + hiddenContentTable(targetType) + `
+		SET hidden_at = COALESCE(hidden_at, now()),
+			hidden_reason = CASE WHEN hidden_reason = 'moderator' THEN hidden_reason ELSE $2 END
+		WHERE id = $1
+	`
+	_, err := tx.ExecContext(ctx, query, targetId, reason)
+	return err
+}
+
+// unhideReported brings back the post or comment if it was only hidden by reports
+func unhideReported(ctx context.Context, tx DBTX, targetType string, targetId int64) error {
+	query := `
+		UPDATE ` + hiddenContentTable(targetType) + `
+		SET hidden_at = NULL, hidden_reason = NULL
+		WHERE id = $1 AND hidden_reason = $2
+	`
+	_, err := tx.ExecContext(ctx, query, targetId, hiddenByReports)
+	return err
+}
+
+const reportColumns = `
+	r.id, r.reporter_id, r.target_type, r.target_id, r.reason, r.details, r.status, r.claimed_by, r.claimed_at,
+	r.resolved_by, r.resolved_at, r.resolution, r.created_at,
+	(SELECT COUNT(*) FROM reports tr WHERE tr.target_type = r.target_type AND tr.target_id = r.target_id)
+`
+
+func scanReport(row interface{ Scan(...any) error }, r *Report) error {
+	return row.Scan(
+		&r.ID,
+		&r.ReporterID,
+		&r.TargetType,
+		&r.TargetID,
+		&r.Reason,
+		&r.Details,
+		&r.Status,
+		&r.ClaimedBy,
+		&r.ClaimedAt,
+		&r.ResolvedBy,
+		&r.ResolvedAt,
+		&r.Resolution,
+		&r.CreatedAt,
+		&r.TargetReports,
+	)
+}
+
+func (s *ReportStore) GetById(ctx context.Context, reportId int64) (*Report, error) {
+	query := `SELECT ` + reportColumns + ` FROM reports r WHERE r.id = $1`
+
+	var r Report
+	if err := scanReport(s.db.QueryRowContext(ctx, query, reportId), &r); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func (s *ReportStore) GetQueue(ctx context.Context, filter ReportFilter, cq CursorPaginatedQuery) (CursorPage[Report], error) {
+	cursorTime, cursorId, err := cursorArgs(cq.Cursor)
+	if err != nil {
+		return CursorPage[Report]{}, err
+	}
+
+	query := `
+		SELECT ` + reportColumns + `
+		FROM reports r
+		WHERE ($1 = '' OR r.status = $1)
+		AND ($2 = '' OR r.target_type = $2)
+		AND ($3::timestamp with time zone IS NULL OR (r.created_at, r.id) < ($3, $4))
+		ORDER BY r.created_at DESC, r.id DESC
+		LIMIT $5
+	`
+
+	// one extra row tells whether there is a next page
+	rows, err := s.db.QueryContext(ctx, query, filter.Status, filter.TargetType, cursorTime, cursorId, cq.Limit+1)
+	if err != nil {
+		return CursorPage[Report]{}, err
+	}
+	defer rows.Close()
+
+	page := CursorPage[Report]{Items: []Report{}}
+	for rows.Next() {
+		var r Report
+		if err := scanReport(rows, &r); err != nil {
+			return CursorPage[Report]{}, err
+		}
+		page.Items = append(page.Items, r)
+	}
+	if err := rows.Err(); err != nil {
+		return CursorPage[Report]{}, err
+	}
+
+	if len(page.Items) > cq.Limit {
+		page.Items = page.Items[:cq.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = EncodeCursor(last.CreatedAt, last.ID)
+	}
+
+	return page, nil
+}
+
+// Claim assigns an open report to the moderator, it returns ErrConflict if
+// another moderator claimed it or it's already closed
+func (s *ReportStore) Claim(ctx context.Context, reportId int64, moderatorId int64) error {
+	query := `
+		UPDATE reports
+		SET status = 'claimed', claimed_by = $2, claimed_at = now()
+		WHERE id = $1 AND (status = 'open' OR (status = 'claimed' AND claimed_by = $2))
+	`
+
+	res, err := s.db.ExecContext(ctx, query, reportId, moderatorId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		if _, err := s.GetById(ctx, reportId); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// Resolve applies the moderation action to the report target, closes every
+// pending report on the same target and records the action. The report must
+// be open or claimed by the moderator, ErrConflict is returned otherwise
+func (s *ReportStore) Resolve(ctx context.Context, report *Report, moderatorId int64, resolution Resolution) error {
+	tx, err := beginTx(ctx, s.db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		status    string
+		claimedBy *int64
+	)
+	err = tx.QueryRowContext(ctx, `SELECT status, claimed_by FROM reports WHERE id = $1 FOR UPDATE`, report.ID).Scan(&status, &claimedBy)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if status != ReportStatusOpen && (status != ReportStatusClaimed || claimedBy == nil || *claimedBy != moderatorId) {
+		return ErrConflict
+	}
+
+	var targetUserId int64
+	if err := tx.QueryRowContext(ctx, targetOwnerQuery, report.TargetType, report.TargetID).Scan(&targetUserId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	switch resolution.Action {
+	case ModerationRemoveContent:
+		if report.TargetType == ReportTargetUser {
+			return ErrInvalidModerationAction
+		}
+		err = hideContent(ctx, tx, report.TargetType, report.TargetID, hiddenByModerator)
+	case ModerationDismiss:
+		if report.TargetType != ReportTargetUser {
+			err = unhideReported(ctx, tx, report.TargetType, report.TargetID)
+		}
+	case ModerationWarn:
+		_, err = tx.ExecContext(ctx, `INSERT INTO user_warnings (user_id, report_id, note) VALUES ($1, $2, $3)`, targetUserId, report.ID, resolution.Note)
+	case ModerationSuspendUser:
+		if resolution.SuspendedUntil == nil {
+			return ErrInvalidModerationAction
+		}
+		err = suspendUser(ctx, tx, targetUserId, resolution.SuspendedUntil, resolution.Note)
+	default:
+		return ErrInvalidModerationAction
+	}
+	if err != nil {
+		return err
+	}
+
+	status = ReportStatusResolved
+	if resolution.Action == ModerationDismiss {
+		status = ReportStatusDismissed
+	}
+
+	// the other pending reports on the target are settled by the same decision
+	closeQuery := `
+		UPDATE reports
+		SET status = $3, resolved_by = $4, resolved_at = now(), resolution = $5
+		WHERE target_type = $1 AND target_id = $2 AND status IN ('open', 'claimed')
+	`
+	_, err = tx.ExecContext(ctx, closeQuery, report.TargetType, report.TargetID, status, moderatorId, resolution.Action)
+	if err != nil {
+		return err
+	}
+
+	actionQuery := `
+		INSERT INTO moderation_actions (moderator_id, report_id, action, target_type, target_id, target_user_id, note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err = tx.ExecContext(ctx, actionQuery, moderatorId, report.ID, resolution.Action, report.TargetType, report.TargetID, targetUserId, resolution.Note)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *ReportStore) GetActions(ctx context.Context, cq CursorPaginatedQuery) (CursorPage[ModerationAction], error) {
+	cursorTime, cursorId, err := cursorArgs(cq.Cursor)
+	if err != nil {
+		return CursorPage[ModerationAction]{}, err
+	}
+
+	query := `
+		SELECT id, moderator_id, report_id, action, target_type, target_id, target_user_id, note, created_at
+		FROM moderation_actions
+		WHERE ($1::timestamp with time zone IS NULL OR (created_at, id) < ($1, $2))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`
+
+	// one extra row tells whether there is a next page
+	rows, err := s.db.QueryContext(ctx, query, cursorTime, cursorId, cq.Limit+1)
+	if err != nil {
+		return CursorPage[ModerationAction]{}, err
+	}
+	defer rows.Close()
+
+	page := CursorPage[ModerationAction]{Items: []ModerationAction{}}
+	for rows.Next() {
+		var a ModerationAction
+		err := rows.Scan(
+			&a.ID,
+			&a.ModeratorID,
+			&a.ReportID,
+			&a.Action,
+			&a.TargetType,
+			&a.TargetID,
+			&a.TargetUserID,
+			&a.Note,
+			&a.CreatedAt,
+		)
+		if err != nil {
+			return CursorPage[ModerationAction]{}, err
+		}
+		page.Items = append(page.Items, a)
+	}
+	if err := rows.Err(); err != nil {
+		return CursorPage[ModerationAction]{}, err
+	}
+
+	if len(page.Items) > cq.Limit {
+		page.Items = page.Items[:cq.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = EncodeCursor(last.CreatedAt, last.ID)
+	}
+
+	return page, nil
+}
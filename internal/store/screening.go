@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ScreeningRuleWord   = "word"
+	ScreeningRuleRegex  = "regex"
+	ScreeningRuleDomain = "domain"
+)
+
+type ScreeningRule struct {
+	ID   int64  `json:"id"`
+	Kind string `json:"kind"`
+	// Pattern is a word, a regular expression or a domain depending on Kind
+	Pattern   string    `json:"pattern"`
+	Action    string    `json:"action"`
+	Reason    *string   `json:"reason"`
+	CreatedBy *int64    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ScreeningStore struct {
+	db DBTX
+}
+
+func (s *ScreeningStore) GetRules(ctx context.Context) ([]ScreeningRule, error) {
+	query := `
+		SELECT id, kind, pattern, action, reason, created_by, created_at
+		FROM screening_rules
+		ORDER BY id
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []ScreeningRule{}
+	for rows.Next() {
+		var rule ScreeningRule
+		err := rows.Scan(
+			&rule.ID,
+			&rule.Kind,
+			&rule.Pattern,
+			&rule.Action,
+			&rule.Reason,
+			&rule.CreatedBy,
+			&rule.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+func (s *ScreeningStore) CreateRule(ctx context.Context, rule *ScreeningRule) error {
+	query := `
+		INSERT INTO screening_rules (kind, pattern, action, reason, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		rule.Kind,
+		rule.Pattern,
+		rule.Action,
+		rule.Reason,
+		rule.CreatedBy,
+	).Scan(&rule.ID, &rule.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		return err
+	}
+
+	return nil
+}
+
+// DeleteRule returns the deleted rule
+func (s *ScreeningStore) DeleteRule(ctx context.Context, ruleId int64) (*ScreeningRule, error) {
+	query := `
+		DELETE FROM screening_rules
+		WHERE id = $1
+		RETURNING id, kind, pattern, action, reason, created_by, created_at
+	`
+
+	var rule ScreeningRule
+	err := s.db.QueryRowContext(ctx, query, ruleId).Scan(
+		&rule.ID,
+		&rule.Kind,
+		&rule.Pattern,
+		&rule.Action,
+		&rule.Reason,
+		&rule.CreatedBy,
+		&rule.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+// CountRecentDuplicates counts the posts and comments of the author created
+// since the given time with the same text, ignoring case and surrounding
+// spaces. excludePostId leaves out the post being edited
+func (s *ScreeningStore) CountRecentDuplicates(ctx context.Context, authorId int64, text string, since time.Time, excludePostId int64) (int, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*)
+			FROM posts
+			WHERE user_id = $1 AND id <> $4 AND deleted_at IS NULL AND created_at >= $3
+			AND lower(btrim(content)) = lower(btrim($2)))
+			+
+			(SELECT COUNT(*)
+			FROM comments
+			WHERE user_id = $1 AND created_at >= $3
+			AND lower(btrim(content)) = lower(btrim($2)))
+	`
+
+	var count int
+	err := s.db.QueryRowContext(ctx, query, authorId, text, since, excludePostId).Scan(&count)
+	return count, err
+}
@@ -4,22 +4,34 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
 	ErrNotFound = errors.New("record not found")
 	ErrConflict = errors.New("resource already exist")
+	ErrBlocked  = errors.New("user is blocked")
 )
 
 type Storage struct {
 	Posts interface {
 		GetByIdWithUser(ctx context.Context, id int64) (*Post, error)
+		GetByIdWithMeta(ctx context.Context, id int64, viewerId int64) (*PostWithMeta, error)
 		Create(context.Context, *Post) error
 		Update(context.Context, *Post) error
 		DeleteById(ctx context.Context, id int64) error
-		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMeta, error)
-		GetExploreFeed(context.Context, PaginatedFeedQuery) ([]PostWithMeta, error)
-		GetUserPostsByUserId(context.Context, int64) ([]PostWithMeta, error)
+		GetUserFeed(ctx context.Context, userId int64, fq CursorFeedQuery, opts FeedOptions) (CursorPage[PostWithMeta], error)
+		GetExploreFeed(ctx context.Context, pfq PaginatedFeedQuery, viewerId int64, opts FeedOptions) ([]PostWithMeta, error)
+		GetUserPostsByUserId(ctx context.Context, userId int64, viewerId int64) ([]PostWithMeta, error)
+		GetUnpublishedByUserId(ctx context.Context, userId int64) ([]Post, error)
+		Schedule(ctx context.Context, post *Post, publishAt *string) error
+		Publish(ctx context.Context, post *Post) error
+		PublishDue(ctx context.Context, limit int) ([]Post, error)
+		GetRevisions(ctx context.Context, postId int64) ([]PostRevision, error)
+		GetRevision(ctx context.Context, postId int64, revision int) (*PostRevision, error)
+		GetTrashByUserId(ctx context.Context, userId int64, retention time.Duration) ([]Post, error)
+		Restore(ctx context.Context, postId int64, userId int64, retention time.Duration) error
+		PurgeDeleted(ctx context.Context, retention time.Duration) (int64, error)
 	}
 	Users interface {
 		GetById(ctx context.Context, id int64) (*User, error)
@@ -28,23 +40,160 @@ type Storage struct {
 		VerifyUser(ctx context.Context, userId int64) error
 		UpdateLastLogin(ctx context.Context, userId int64) error
 		GetProfileById(ctx context.Context, userId int64, currUserIdIfExist *int64) (ProfileData, error)
+		UpdateSettings(ctx context.Context, userId int64, settings UserSettings) error
+		GetIdsByUsernames(ctx context.Context, usernames []string) (map[string]int64, error)
+		UpdateRole(ctx context.Context, userId int64, role string) error
+		GetStatus(ctx context.Context, userId int64) (AccountStatus, error)
 	}
 	Comments interface {
-		GetByPostIdWithUser(ctx context.Context, postID int64) ([]Comment, error)
+		GetByPostIdWithUser(ctx context.Context, postID int64, viewerId int64) ([]Comment, error)
+		GetAuthorId(ctx context.Context, postId int64, commentId int64) (int64, error)
+		GetPostId(ctx context.Context, commentId int64) (int64, error)
 		Create(context.Context, *Comment) error
 	}
 	Followers interface {
 		Follow(ctx context.Context, followerId int64, followedId int64) error
 		Unfollow(ctx context.Context, followerId int64, followedId int64) error
 		IsFollowed(ctx context.Context, followerId int64, followedId int64) (bool, error)
+		GetFollowers(ctx context.Context, userId int64, viewerId int64, cq CursorPaginatedQuery) (CursorPage[FollowEntry], error)
+		GetFollowing(ctx context.Context, userId int64, viewerId int64, cq CursorPaginatedQuery) (CursorPage[FollowEntry], error)
+		GetFollowedBy(ctx context.Context, userId int64, viewerId int64, limit int) (FollowedBySummary, error)
+		GetFollowingIds(ctx context.Context, userId int64) ([]int64, error)
 	}
+	Timelines interface {
+		FanOut(ctx context.Context, postId int64) error
+		Backfill(ctx context.Context, followerId int64, followedId int64, limit int) error
+		Prune(ctx context.Context, followerId int64, followedId int64) error
+	}
+	FollowedTags interface {
+		Follow(ctx context.Context, userId int64, tag string) error
+		Unfollow(ctx context.Context, userId int64, tag string) error
+		GetByUserId(ctx context.Context, userId int64) ([]string, error)
+	}
+	Mutes interface {
+		MuteTerm(ctx context.Context, userId int64, kind MuteKind, term string) error
+		UnmuteTerm(ctx context.Context, userId int64, kind MuteKind, term string) error
+		MuteUser(ctx context.Context, userId int64, mutedUserId int64) error
+		UnmuteUser(ctx context.Context, userId int64, mutedUserId int64) error
+		GetByUserId(ctx context.Context, userId int64) (Mutes, error)
+	}
+	Blocks interface {
+		Block(ctx context.Context, blockerId int64, blockedId int64) error
+		Unblock(ctx context.Context, blockerId int64, blockedId int64) error
+		IsBlockedEither(ctx context.Context, userId int64, otherUserId int64) (bool, error)
+		GetBlockedUsers(ctx context.Context, userId int64) ([]User, error)
+	}
+	FollowRequests interface {
+		Create(ctx context.Context, requesterId int64, userId int64) error
+		Delete(ctx context.Context, requesterId int64, userId int64) error
+		Accept(ctx context.Context, requesterId int64, userId int64) error
+		GetPendingByUserId(ctx context.Context, userId int64) ([]FollowRequest, error)
+	}
+	Suggestions interface {
+		Compute(ctx context.Context, userId int64, limit int) ([]Suggestion, error)
+		GetByUserId(ctx context.Context, userId int64, limit int) ([]Suggestion, error)
+		Refresh(ctx context.Context, userId int64, limit int) error
+		RefreshActive(ctx context.Context, limit int) error
+	}
+	Mentions interface {
+		SyncPost(ctx context.Context, post *Post) ([]User, error)
+		CreateForComment(ctx context.Context, comment *Comment) ([]User, error)
+		GetMentionedPosts(ctx context.Context, userId int64, pfq PaginatedFeedQuery) ([]PostWithMeta, error)
+	}
+	Notifications interface {
+		Create(ctx context.Context, recipientIds []int64, actorId int64, kind NotificationType, postId *int64) ([]int64, error)
+		GetByUserId(ctx context.Context, userId int64, cq CursorPaginatedQuery) (CursorPage[Notification], error)
+		MarkRead(ctx context.Context, userId int64, notificationId int64) error
+		MarkAllRead(ctx context.Context, userId int64) error
+		GetUnreadCount(ctx context.Context, userId int64) (int, error)
+	}
+	StreamTickets interface {
+		Create(ctx context.Context, userId int64, ttl time.Duration) (string, time.Time, error)
+		Consume(ctx context.Context, ticket string) (int64, error)
+		PurgeExpired(ctx context.Context) (int64, error)
+	}
+	Messages interface {
+		CreateConversation(ctx context.Context, conv *Conversation, memberIds []int64) error
+		GetConversation(ctx context.Context, conversationId int64, userId int64) (*Conversation, error)
+		GetConversations(ctx context.Context, userId int64, cq CursorPaginatedQuery) (CursorPage[ConversationSummary], error)
+		Send(ctx context.Context, msg *Message) error
+		GetMessages(ctx context.Context, conversationId int64, viewerId int64, cq CursorPaginatedQuery) (CursorPage[Message], error)
+		MarkRead(ctx context.Context, conversationId int64, userId int64, messageId int64) (int64, error)
+	}
+	Reports interface {
+		Create(ctx context.Context, report *Report, autoHideThreshold int) (bool, error)
+		GetTargetOwnerId(ctx context.Context, targetType string, targetId int64) (int64, error)
+		GetById(ctx context.Context, reportId int64) (*Report, error)
+		GetQueue(ctx context.Context, filter ReportFilter, cq CursorPaginatedQuery) (CursorPage[Report], error)
+		Claim(ctx context.Context, reportId int64, moderatorId int64) error
+		Resolve(ctx context.Context, report *Report, moderatorId int64, resolution Resolution) error
+		GetActions(ctx context.Context, cq CursorPaginatedQuery) (CursorPage[ModerationAction], error)
+	}
+	Suspensions interface {
+		GetActive(ctx context.Context, userId int64) (*Suspension, error)
+		Suspend(ctx context.Context, moderatorId int64, userId int64, until *time.Time, reason string) error
+		Lift(ctx context.Context, moderatorId int64, userId int64) error
+	}
+	Screening interface {
+		GetRules(ctx context.Context) ([]ScreeningRule, error)
+		CreateRule(ctx context.Context, rule *ScreeningRule) error
+		DeleteRule(ctx context.Context, ruleId int64) (*ScreeningRule, error)
+		CountRecentDuplicates(ctx context.Context, authorId int64, text string, since time.Time, excludePostId int64) (int, error)
+	}
+	Audit interface {
+		Create(ctx context.Context, entry *AuditEntry) error
+		Query(ctx context.Context, filter AuditFilter, cq CursorPaginatedQuery) (CursorPage[AuditEntry], error)
+		Export(ctx context.Context, filter AuditFilter, fn func(AuditEntry) error) error
+	}
+	Exports interface {
+		Create(ctx context.Context, userId int64, staleAfter time.Duration) (*DataExport, error)
+		GetById(ctx context.Context, exportId int64) (*DataExport, error)
+		MarkReady(ctx context.Context, export *DataExport, filePath string, expiresAt time.Time) error
+		MarkFailed(ctx context.Context, exportId int64, reason string) error
+		ExpireReady(ctx context.Context) ([]string, error)
+		Collect(ctx context.Context, userId int64) (*UserArchive, error)
+	}
+	AccountDeletions interface {
+		Request(ctx context.Context, userId int64) (time.Time, error)
+		Cancel(ctx context.Context, userId int64) (bool, error)
+		GetDue(ctx context.Context, grace time.Duration, limit int) ([]int64, error)
+		Purge(ctx context.Context, userId int64, grace time.Duration, content string) ([]string, error)
+	}
+
+	// TxConfig is used by WithTx
+	TxConfig TxConfig
+	// db is nil for the Storage of a transaction
+	db *sql.DB
 }
 
 func NewStorage(db *sql.DB) *Storage {
+	s := newStorage(db)
+	s.TxConfig = DefaultTxConfig
+	s.db = db
+	return s
+}
+
+func newStorage(db DBTX) *Storage {
 	return &Storage{
-		Posts:     &PostStore{db},
-		Users:     &UserStore{db},
-		Comments:  &CommentStore{db},
-		Followers: &FollowerStore{db},
+		Posts:            &PostStore{db},
+		Users:            &UserStore{db},
+		Comments:         &CommentStore{db},
+		Followers:        &FollowerStore{db},
+		Timelines:        &TimelineStore{db},
+		FollowedTags:     &FollowedTagStore{db},
+		Mutes:            &MuteStore{db},
+		Blocks:           &BlockStore{db},
+		FollowRequests:   &FollowRequestStore{db},
+		Suggestions:      &SuggestionStore{db},
+		Mentions:         &MentionStore{db},
+		Notifications:    &NotificationStore{db},
+		StreamTickets:    &StreamTicketStore{db},
+		Messages:         &MessageStore{db},
+		Reports:          &ReportStore{db},
+		Suspensions:      &SuspensionStore{db},
+		Screening:        &ScreeningStore{db},
+		Audit:            &AuditStore{db},
+		Exports:          &ExportStore{db},
+		AccountDeletions: &AccountDeletionStore{db},
 	}
 }
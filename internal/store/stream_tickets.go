@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+type StreamTicketStore struct {
+	db DBTX
+}
+
+// Create issues a ticket of the user valid for ttl and returns it with its
+// expiry, only its hash is stored
+func (s *StreamTicketStore) Create(ctx context.Context, userId int64, ttl time.Duration) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	ticket := hex.EncodeToString(raw)
+
+	query := `
+		INSERT INTO stream_tickets (ticket_hash, user_id, expires_at)
+		VALUES ($1, $2, now() + make_interval(secs => $3))
+		RETURNING expires_at
+	`
+
+	var expiresAt time.Time
+	if err := s.db.QueryRowContext(ctx, query, hashStreamTicket(ticket), userId, ttl.Seconds()).Scan(&expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return ticket, expiresAt, nil
+}
+
+// Consume uses up the ticket and returns its user, ErrNotFound if it doesn't
+// exist, was already used or expired
+func (s *StreamTicketStore) Consume(ctx context.Context, ticket string) (int64, error) {
+	query := `
+		DELETE FROM stream_tickets
+		WHERE ticket_hash = $1
+		RETURNING user_id, expires_at > now()
+	`
+
+	var userId int64
+	var valid bool
+	if err := s.db.QueryRowContext(ctx, query, hashStreamTicket(ticket)).Scan(&userId, &valid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+	if !valid {
+		return 0, ErrNotFound
+	}
+
+	return userId, nil
+}
+
+// PurgeExpired deletes the expired tickets that were never used
+func (s *StreamTicketStore) PurgeExpired(ctx context.Context) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM stream_tickets WHERE expires_at <= now()`)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func hashStreamTicket(ticket string) []byte {
+	sum := sha256.Sum256([]byte(ticket))
+	return sum[:]
+}
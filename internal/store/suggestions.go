@@ -0,0 +1,238 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+type Suggestion struct {
+	User              User     `json:"user"`
+	Score             float64  `json:"score"`
+	MutualCount       int      `json:"mutual_count"`
+	MutualUsernames   []string `json:"mutual_usernames"`
+	SharedTagsCount   int      `json:"shared_tags_count"`
+	CoEngagementCount int      `json:"co_engagement_count"`
+	Reason            string   `json:"reason"`
+}
+
+type SuggestionStore struct {
+	db DBTX
+}
+
+// suggestionsQuery scores the candidates of the user bound to $1 by friends of
+// friends, shared followed tags and comments on the same posts, $2 is the limit
+const suggestionsQuery = `
+	WITH fof AS (
+		SELECT f2.user_id AS candidate_id,
+			COUNT(*) AS mutual_count,
+			(array_agg(u.username ORDER BY f1.created_at DESC))[1:2] AS mutual_usernames
+		FROM followers f1
+		JOIN followers f2
+		ON f2.follower_id = f1.user_id
+		JOIN users u
+		ON u.id = f1.user_id
+		WHERE f1.follower_id = $1
+		GROUP BY f2.user_id
+	),
+	shared_tags AS (
+		SELECT p.user_id AS candidate_id, COUNT(DISTINCT ft.tag) AS shared_tags_count
+		FROM followed_tags ft
+		JOIN posts p
+		ON EXISTS (SELECT 1 FROM unnest(p.tags) AS pt(tag) WHERE lower(pt.tag) = ft.tag)
+		WHERE ft.user_id = $1 AND p.deleted_at IS NULL AND p.hidden_at IS NULL
+		GROUP BY p.user_id
+	),
+	co_engagement AS (
+		SELECT c2.user_id AS candidate_id, COUNT(DISTINCT c2.post_id) AS co_engagement_count
+		FROM comments c1
+		JOIN comments c2
+		ON c2.post_id = c1.post_id
+		WHERE c1.user_id = $1
+		GROUP BY c2.user_id
+	),
+	candidates AS (
+		SELECT candidate_id FROM fof
+		UNION SELECT candidate_id FROM shared_tags
+		UNION SELECT candidate_id FROM co_engagement
+	)
+	SELECT u.id, u.username, u.image_url,
+		COALESCE(fof.mutual_count, 0),
+		COALESCE(fof.mutual_usernames, '{}'),
+		COALESCE(st.shared_tags_count, 0),
+		COALESCE(ce.co_engagement_count, 0),
+		(3 * COALESCE(fof.mutual_count, 0) + 2 * COALESCE(st.shared_tags_count, 0) + COALESCE(ce.co_engagement_count, 0))::double precision AS score
+	FROM candidates c
+	JOIN users u
+	ON u.id = c.candidate_id
+	LEFT JOIN fof ON fof.candidate_id = c.candidate_id
+	LEFT JOIN shared_tags st ON st.candidate_id = c.candidate_id
+	LEFT JOIN co_engagement ce ON ce.candidate_id = c.candidate_id
+	WHERE ` + suggestableClause + `
+	ORDER BY score DESC, u.id
+	LIMIT $2
+`
+
+// suggestableClause excludes self, followed, requested and blocked users
+// (aliased u) from the suggestions of the user bound to $1
+const suggestableClause = `u.id <> $1
+	AND NOT EXISTS (SELECT 1 FROM followers sf WHERE sf.user_id = u.id AND sf.follower_id = $1)
+	AND NOT EXISTS (SELECT 1 FROM follow_requests sr WHERE sr.user_id = u.id AND sr.requester_id = $1)
+	AND NOT EXISTS (
+		SELECT 1 FROM blocks b
+		WHERE (b.user_id = $1 AND b.blocked_user_id = u.id) OR (b.user_id = u.id AND b.blocked_user_id = $1)
+	)`
+
+// Compute scores the suggestions on demand
+func (s *SuggestionStore) Compute(ctx context.Context, userId int64, limit int) ([]Suggestion, error) {
+	rows, err := s.db.QueryContext(ctx, suggestionsQuery, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSuggestions(rows)
+}
+
+// GetByUserId returns the precomputed suggestions, the ones that stopped being
+// suggestable since they were computed (followed, blocked...) are skipped
+func (s *SuggestionStore) GetByUserId(ctx context.Context, userId int64, limit int) ([]Suggestion, error) {
+	query := `
+		SELECT u.id, u.username, u.image_url, fs.mutual_count, fs.mutual_usernames, fs.shared_tags_count, fs.co_engagement_count, fs.score
+		FROM follow_suggestions fs
+		JOIN users u
+		ON u.id = fs.suggested_user_id
+		WHERE fs.user_id = $1
+		AND ` + suggestableClause + `
+		ORDER BY fs.score DESC, u.id
+		LIMIT $2
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSuggestions(rows)
+}
+
+// Refresh replaces the precomputed suggestions of a user
+func (s *SuggestionStore) Refresh(ctx context.Context, userId int64, limit int) error {
+	suggestions, err := s.Compute(ctx, userId, limit)
+	if err != nil {
+		return err
+	}
+
+	tx, err := beginTx(ctx, s.db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM follow_suggestions WHERE user_id = $1`, userId); err != nil {
+		return err
+	}
+
+	insertQuery := `
+		INSERT INTO follow_suggestions(user_id, suggested_user_id, score, mutual_count, mutual_usernames, shared_tags_count, co_engagement_count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	for _, sg := range suggestions {
+		_, err := tx.ExecContext(
+			ctx,
+			insertQuery,
+			userId,
+			sg.User.ID,
+			sg.Score,
+			sg.MutualCount,
+			pq.Array(sg.MutualUsernames),
+			sg.SharedTagsCount,
+			sg.CoEngagementCount,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RefreshActive refreshes the suggestions of the users who logged in recently
+func (s *SuggestionStore) RefreshActive(ctx context.Context, limit int) error {
+	query := `
+		SELECT id
+		FROM users
+		WHERE last_login_at > now() - interval '30 days'
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	var userIds []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		userIds = append(userIds, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range userIds {
+		if err := s.Refresh(ctx, id, limit); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scanSuggestions(rows *sql.Rows) ([]Suggestion, error) {
+	suggestions := []Suggestion{}
+	for rows.Next() {
+		var sg Suggestion
+		err := rows.Scan(
+			&sg.User.ID,
+			&sg.User.Username,
+			&sg.User.ImgUrl,
+			&sg.MutualCount,
+			pq.Array(&sg.MutualUsernames),
+			&sg.SharedTagsCount,
+			&sg.CoEngagementCount,
+			&sg.Score,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sg.Reason = explainSuggestion(sg)
+		suggestions = append(suggestions, sg)
+	}
+
+	return suggestions, rows.Err()
+}
+
+func explainSuggestion(sg Suggestion) string {
+	switch {
+	case sg.MutualCount == 1 && len(sg.MutualUsernames) > 0:
+		return "followed by " + sg.MutualUsernames[0]
+	case sg.MutualCount == 2 && len(sg.MutualUsernames) > 1:
+		return "followed by " + sg.MutualUsernames[0] + " and " + sg.MutualUsernames[1]
+	case sg.MutualCount > 2 && len(sg.MutualUsernames) > 0:
+		return fmt.Sprintf("followed by %s and %d others", sg.MutualUsernames[0], sg.MutualCount-1)
+	case sg.SharedTagsCount > 0:
+		return "posts about tags you follow"
+	case sg.CoEngagementCount > 0:
+		return "comments on the same posts as you"
+	default:
+		return "suggested for you"
+	}
+}
@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	ModerationBanUser     = "ban_user"
+	ModerationLiftSuspend = "lift_suspension"
+)
+
+// ErrSuspendStaff is returned when suspending or banning a moderator or an admin
+var ErrSuspendStaff = errors.New("moderators and admins must be demoted before being suspended")
+
+type Suspension struct {
+	UserID int64 `json:"user_id"`
+	// Until is nil for permanent bans
+	Until     *time.Time `json:"suspended_until"`
+	Permanent bool       `json:"permanent"`
+	Reason    *string    `json:"reason"`
+}
+
+type SuspensionStore struct {
+	db DBTX
+}
+
+// activeSuspensionClause matches the users (aliased u) currently suspended or banned
+const activeSuspensionClause = `(u.banned_at IS NOT NULL OR u.suspended_until > now())`
+
+// GetActive returns the ongoing suspension of the user, ErrNotFound if there is none
+func (s *SuspensionStore) GetActive(ctx context.Context, userId int64) (*Suspension, error) {
+	query := `
+		SELECT u.id, u.suspended_until, u.banned_at IS NOT NULL, u.suspension_reason
+		FROM users u
+		WHERE u.id = $1 AND ` + activeSuspensionClause + `
+	`
+
+	var suspension Suspension
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(
+		&suspension.UserID,
+		&suspension.Until,
+		&suspension.Permanent,
+		&suspension.Reason,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	if suspension.Permanent {
+		suspension.Until = nil
+	}
+
+	return &suspension, nil
+}
+
+// Suspend suspends the user until the given time, or bans them for good when
+// until is nil, and records the moderator action. Staff can't be suspended,
+// ErrSuspendStaff is returned for them
+func (s *SuspensionStore) Suspend(ctx context.Context, moderatorId int64, userId int64, until *time.Time, reason string) error {
+	tx, err := beginTx(ctx, s.db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	action := ModerationSuspendUser
+	if until == nil {
+		action = ModerationBanUser
+		err = banUser(ctx, tx, userId, reason)
+	} else {
+		err = suspendUser(ctx, tx, userId, until, &reason)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := recordUserAction(ctx, tx, moderatorId, action, userId, &reason); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Lift ends the suspension or ban of the user, ErrNotFound if there is none
+func (s *SuspensionStore) Lift(ctx context.Context, moderatorId int64, userId int64) error {
+	tx, err := beginTx(ctx, s.db, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users u
+		SET suspended_until = NULL, banned_at = NULL, suspension_reason = NULL
+		WHERE u.id = $1 AND ` + activeSuspensionClause + `
+	`
+	res, err := tx.ExecContext(ctx, query, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	if err := recordUserAction(ctx, tx, moderatorId, ModerationLiftSuspend, userId, nil); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// suspendUser lifts a previous ban too, the latest decision wins. The role
+// is checked here since the report resolutions suspend users too
+func suspendUser(ctx context.Context, tx DBTX, userId int64, until *time.Time, reason *string) error {
+	query := `UPDATE users SET suspended_until = $2, banned_at = NULL, suspension_reason = $3 WHERE id = $1 AND role = 'user'`
+	res, err := tx.ExecContext(ctx, query, userId, until, reason)
+	if err != nil {
+		return err
+	}
+
+	return checkSuspended(ctx, tx, res, userId)
+}
+
+func banUser(ctx context.Context, tx DBTX, userId int64, reason string) error {
+	query := `UPDATE users SET banned_at = now(), suspended_until = NULL, suspension_reason = $2 WHERE id = $1 AND role = 'user'`
+	res, err := tx.ExecContext(ctx, query, userId, reason)
+	if err != nil {
+		return err
+	}
+
+	return checkSuspended(ctx, tx, res, userId)
+}
+
+// checkSuspended tells a missing user from a staff member when the
+// suspension updated no row
+func checkSuspended(ctx context.Context, tx DBTX, res sql.Result, userId int64) error {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows > 0 {
+		return nil
+	}
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userId).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrSuspendStaff
+	}
+	return ErrNotFound
+}
+
+func recordUserAction(ctx context.Context, tx DBTX, moderatorId int64, action string, userId int64, note *string) error {
+	query := `
+		INSERT INTO moderation_actions (moderator_id, action, target_type, target_id, target_user_id, note)
+		VALUES ($1, $2, 'user', $3, $3, $4)
+	`
+	_, err := tx.ExecContext(ctx, query, moderatorId, action, userId, note)
+	return err
+}
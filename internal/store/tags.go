@@ -0,0 +1,69 @@
+package store
+
+import (
+	"context"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type FollowedTagStore struct {
+	db DBTX
+}
+
+// NormalizeTag lowercases the tag and strips the optional leading '#'
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+func (s *FollowedTagStore) Follow(ctx context.Context, userId int64, tag string) error {
+	query := `
+		INSERT INTO followed_tags(user_id, tag)
+		VALUES ($1, $2)
+	`
+
+	_, err := s.db.ExecContext(ctx, query, userId, NormalizeTag(tag))
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+	}
+
+	return err
+}
+
+func (s *FollowedTagStore) Unfollow(ctx context.Context, userId int64, tag string) error {
+	query := `
+		DELETE FROM followed_tags
+		WHERE user_id = $1 AND tag = $2
+	`
+
+	_, err := s.db.ExecContext(ctx, query, userId, NormalizeTag(tag))
+	return err
+}
+
+func (s *FollowedTagStore) GetByUserId(ctx context.Context, userId int64) ([]string, error) {
+	query := `
+		SELECT tag
+		FROM followed_tags
+		WHERE user_id = $1
+		ORDER BY tag
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
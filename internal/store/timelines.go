@@ -0,0 +1,64 @@
+package store
+
+import (
+	"context"
+)
+
+// CelebrityFollowerThreshold is the follower count from which an author's posts
+// are no longer pushed into every follower's timeline on write, instead they
+// are merged into the feed at read time.
+const CelebrityFollowerThreshold = 10000
+
+type TimelineStore struct {
+	db DBTX
+}
+
+// FanOut pushes the post into the timeline of every follower of its author,
+// posts of celebrity authors are skipped as they are merged at read time
+func (s *TimelineStore) FanOut(ctx context.Context, postId int64) error {
+	query := `
+		INSERT INTO timelines (user_id, post_id, author_id, created_at)
+		SELECT f.follower_id, p.id, p.user_id, p.created_at
+		FROM posts p
+		JOIN followers f
+		ON f.user_id = p.user_id
+		JOIN users a
+		ON a.id = p.user_id
+		WHERE p.id = $1
+		AND a.follower_count < $2
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err := s.db.ExecContext(ctx, query, postId, CelebrityFollowerThreshold)
+	return err
+}
+
+// Backfill copies the latest posts of followedId into the timeline of followerId
+func (s *TimelineStore) Backfill(ctx context.Context, followerId int64, followedId int64, limit int) error {
+	query := `
+		INSERT INTO timelines (user_id, post_id, author_id, created_at)
+		SELECT $1, p.id, p.user_id, p.created_at
+		FROM posts p
+		JOIN users a
+		ON a.id = p.user_id
+		WHERE p.user_id = $2 AND p.deleted_at IS NULL AND p.hidden_at IS NULL
+		AND a.follower_count < $3
+		ORDER BY p.created_at DESC
+		LIMIT $4
+		ON CONFLICT DO NOTHING
+	`
+
+	_, err := s.db.ExecContext(ctx, query, followerId, followedId, CelebrityFollowerThreshold, limit)
+	return err
+}
+
+// Prune removes every post of followedId from the timeline of followerId
+func (s *TimelineStore) Prune(ctx context.Context, followerId int64, followedId int64) error {
+	query := `
+		DELETE FROM timelines
+		WHERE user_id = $1 AND author_id = $2
+	`
+
+	_, err := s.db.ExecContext(ctx, query, followerId, followedId)
+	return err
+}
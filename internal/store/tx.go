@@ -0,0 +1,163 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DBTX is what the stores query through, the *sql.DB or the *sql.Tx of WithTx
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type TxConfig struct {
+	Isolation sql.IsolationLevel
+	// MaxRetries is how many times a transaction failing on a serialization
+	// failure or a deadlock is run again
+	MaxRetries int
+	// RetryDelay doubles after every retry
+	RetryDelay time.Duration
+}
+
+var DefaultTxConfig = TxConfig{
+	Isolation:  sql.LevelDefault,
+	MaxRetries: 3,
+	RetryDelay: 10 * time.Millisecond,
+}
+
+// ParseIsolationLevel maps read_committed, repeatable_read and serializable
+// to their level, an empty name is the db default
+func ParseIsolationLevel(name string) (sql.IsolationLevel, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return sql.LevelDefault, nil
+	case "read_committed":
+		return sql.LevelReadCommitted, nil
+	case "repeatable_read":
+		return sql.LevelRepeatableRead, nil
+	case "serializable":
+		return sql.LevelSerializable, nil
+	}
+	return sql.LevelDefault, fmt.Errorf("unknown isolation level %q", name)
+}
+
+// WithTx runs fn with a Storage whose stores all share one transaction, it's
+// committed when fn returns nil and rolled back otherwise. On serialization
+// failures and deadlocks fn runs again from the start, so it must not have
+// side effects outside the db. Calling WithTx on the Storage given to fn
+// joins the running transaction
+func (s *Storage) WithTx(ctx context.Context, fn func(tx *Storage) error) error {
+	return s.WithTxConfig(ctx, s.TxConfig, fn)
+}
+
+// WithTxConfig is WithTx with another isolation level or retry policy
+func (s *Storage) WithTxConfig(ctx context.Context, cfg TxConfig, fn func(tx *Storage) error) error {
+	if s.db == nil {
+		return fn(s)
+	}
+
+	delay := cfg.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err := s.runTx(ctx, cfg.Isolation, fn)
+		if err == nil || !isRetryable(err) || attempt >= cfg.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (s *Storage) runTx(ctx context.Context, isolation sql.IsolationLevel, fn func(tx *Storage) error) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: isolation})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	txStorage := newStorage(tx)
+	txStorage.TxConfig = s.TxConfig
+	if err := fn(txStorage); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// isRetryable matches serialization failures and deadlocks, the transaction
+// was rolled back and can run again
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
+}
+
+// txn is the transaction of a multi-statement store method. Inside WithTx it
+// is a savepoint of the running transaction, so the method's rollback only
+// undoes its own statements and its commit leaves the outcome to WithTx
+type txn struct {
+	*sql.Tx
+	ctx       context.Context
+	savepoint bool
+	done      bool
+}
+
+const txnSavepoint = "store_txn"
+
+// beginTx starts a txn on db, opts only apply outside WithTx where the
+// method owns the transaction
+func beginTx(ctx context.Context, db DBTX, opts *sql.TxOptions) (*txn, error) {
+	switch db := db.(type) {
+	case *sql.DB:
+		tx, err := db.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &txn{Tx: tx, ctx: ctx}, nil
+	case *sql.Tx:
+		if _, err := db.ExecContext(ctx, `SAVEPOINT `+txnSavepoint); err != nil {
+			return nil, err
+		}
+		return &txn{Tx: db, ctx: ctx, savepoint: true}, nil
+	}
+	return nil, fmt.Errorf("can't begin a transaction on %T", db)
+}
+
+func (t *txn) Commit() error {
+	if !t.savepoint {
+		return t.Tx.Commit()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.Tx.ExecContext(t.ctx, `RELEASE SAVEPOINT `+txnSavepoint)
+	return err
+}
+
+// Rollback is deferred right after beginTx, it's a no-op once committed
+func (t *txn) Rollback() error {
+	if !t.savepoint {
+		return t.Tx.Rollback()
+	}
+	if t.done {
+		return sql.ErrTxDone
+	}
+	t.done = true
+	_, err := t.Tx.ExecContext(t.ctx, `ROLLBACK TO SAVEPOINT `+txnSavepoint)
+	return err
+}
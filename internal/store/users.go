@@ -5,6 +5,14 @@ import (
 	"database/sql"
 	"errors"
 	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
 )
 
 type User struct {
@@ -16,21 +24,29 @@ type User struct {
 	Password    string       `json:"-"`
 	Role        string       `json:"role"`
 	Verified    bool         `json:"verified"`
+	IsPrivate   bool         `json:"is_private"`
+	DMPolicy    string       `json:"dm_policy"`
 	LastLoginAt sql.NullTime `json:"last_login_at"`
 	CreatedAt   string       `json:"created_at"`
 	UpdatedAt   string       `json:"updated_at"`
 }
 
 type ProfileData struct {
-	User           *User `json:"user"`
-	IsFollowed     bool  `json:"is_followed"`
-	PostsCount     int   `json:"posts_count"`
-	FollowersCount int   `json:"followers_count"`
-	FollowingCount int   `json:"following_count"`
+	User          *User `json:"user"`
+	IsFollowed    bool  `json:"is_followed"`
+	IsBlocked     bool  `json:"is_blocked"`
+	HasBlockedYou bool  `json:"has_blocked_you"`
+	// IsFollowRequested is true while the viewer's follow request is pending
+	IsFollowRequested bool `json:"is_follow_requested"`
+	// FollowedBy is only set for logged in viewers
+	FollowedBy     *FollowedBySummary `json:"followed_by,omitempty"`
+	PostsCount     int                `json:"posts_count"`
+	FollowersCount int                `json:"followers_count"`
+	FollowingCount int                `json:"following_count"`
 }
 
 type UserStore struct {
-	db *sql.DB
+	db DBTX
 }
 
 func (s *UserStore) Create(ctx context.Context, user *User) error {
@@ -55,7 +71,7 @@ func (s *UserStore) Create(ctx context.Context, user *User) error {
 
 func (s *UserStore) GetById(ctx context.Context, id int64) (*User, error) {
 	query := `
-		SELECT id, username, email, password, role, verified, last_login_at, created_at, updated_at, image_url
+		SELECT id, username, email, password, role, verified, is_private, dm_policy, last_login_at, created_at, updated_at, image_url
 		FROM users
 		WHERE id = $1
 	`
@@ -68,6 +84,8 @@ func (s *UserStore) GetById(ctx context.Context, id int64) (*User, error) {
 		&user.Password,
 		&user.Role,
 		&user.Verified,
+		&user.IsPrivate,
+		&user.DMPolicy,
 		&user.LastLoginAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -83,9 +101,41 @@ func (s *UserStore) GetById(ctx context.Context, id int64) (*User, error) {
 	return &user, nil
 }
 
+// GetIdsByUsernames maps the given lowercased usernames to the ids of the
+// matching users, unknown usernames are left out
+func (s *UserStore) GetIdsByUsernames(ctx context.Context, usernames []string) (map[string]int64, error) {
+	ids := map[string]int64{}
+	if len(usernames) == 0 {
+		return ids, nil
+	}
+
+	query := `
+		SELECT lower(username), id
+		FROM users
+		WHERE lower(username) = ANY($1) AND NOT is_system
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var username string
+		var id int64
+		if err := rows.Scan(&username, &id); err != nil {
+			return nil, err
+		}
+		ids[username] = id
+	}
+
+	return ids, rows.Err()
+}
+
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, username, email, password, role, verified, last_login_at, created_at, updated_at, image_url
+		SELECT id, username, email, password, role, verified, is_private, dm_policy, last_login_at, created_at, updated_at, image_url
 		FROM users
 		WHERE email = $1
 	`
@@ -98,6 +148,8 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 		&user.Password,
 		&user.Role,
 		&user.Verified,
+		&user.IsPrivate,
+		&user.DMPolicy,
 		&user.LastLoginAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
@@ -141,6 +193,90 @@ func (s *UserStore) VerifyUser(ctx context.Context, userId int64) error {
 	return err
 }
 
+const (
+	DMPolicyEveryone = "everyone"
+	// DMPolicyMutuals only lets the users the account follows and is followed
+	// by start a conversation with it
+	DMPolicyMutuals = "mutuals"
+)
+
+type UserSettings struct {
+	IsPrivate bool   `json:"is_private"`
+	DMPolicy  string `json:"dm_policy"`
+}
+
+func (s *UserStore) UpdateSettings(ctx context.Context, userId int64, settings UserSettings) error {
+	query := `
+		UPDATE users
+		SET is_private = $1, dm_policy = $2, updated_at = now()
+		WHERE id = $3
+	`
+
+	_, err := s.db.ExecContext(ctx, query, settings.IsPrivate, settings.DMPolicy, userId)
+	return err
+}
+
+func (s *UserStore) UpdateRole(ctx context.Context, userId int64, role string) error {
+	query := `UPDATE users SET role = $1, updated_at = now() WHERE id = $2`
+
+	res, err := s.db.ExecContext(ctx, query, role, userId)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// AccountStatus is what AuthenticateMiddleware checks on every request
+type AccountStatus struct {
+	// Suspension is nil unless the user is suspended or banned
+	Suspension          *Suspension
+	DeletionRequestedAt *time.Time
+}
+
+// GetStatus returns ErrNotFound once the account is purged
+func (s *UserStore) GetStatus(ctx context.Context, userId int64) (AccountStatus, error) {
+	query := `
+		SELECT u.suspended_until, u.banned_at IS NOT NULL, u.suspension_reason, ` + activeSuspensionClause + `, u.deletion_requested_at
+		FROM users u
+		WHERE u.id = $1
+	`
+
+	var status AccountStatus
+	suspension := Suspension{UserID: userId}
+	var suspended bool
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(
+		&suspension.Until,
+		&suspension.Permanent,
+		&suspension.Reason,
+		&suspended,
+		&status.DeletionRequestedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return status, ErrNotFound
+		}
+		return status, err
+	}
+
+	if suspended {
+		if suspension.Permanent {
+			suspension.Until = nil
+		}
+		status.Suspension = &suspension
+	}
+
+	return status, nil
+}
+
 func (s *UserStore) GetProfileById(ctx context.Context, userId int64, currUserIdIfExist *int64) (ProfileData, error) {
 	query := `
 		SELECT 
@@ -152,25 +288,25 @@ func (s *UserStore) GetProfileById(ctx context.Context, userId int64, currUserId
 			u."role", 
 			u.last_login_at, 
 			u.verified, 
+			u.is_private,
 			u.created_at, 
 			u.updated_at, 
-			COUNT(DISTINCT f1.user_id) AS following_count, -- Counting who the user is following
-			COUNT(DISTINCT f2.follower_id) AS followers_count,  -- Counting followers
-			COUNT(p.id) AS posts_count,
+			(SELECT COUNT(*) FROM followers WHERE follower_id = u.id) AS following_count,
+			u.follower_count AS followers_count, -- maintained by a trigger on followers
+			(
+				SELECT COUNT(*) FROM posts p
+				WHERE p.user_id = u.id AND p.status = 'published' AND p.deleted_at IS NULL AND p.hidden_at IS NULL
+			) AS posts_count,
 			CASE 
 				WHEN EXISTS (SELECT 1 FROM followers WHERE user_id = u.id AND follower_id = $2) THEN TRUE
 				ELSE FALSE
-			END AS is_followed
+			END AS is_followed,
+			EXISTS (SELECT 1 FROM blocks WHERE user_id = $2 AND blocked_user_id = u.id) AS is_blocked,
+			EXISTS (SELECT 1 FROM blocks WHERE user_id = u.id AND blocked_user_id = $2) AS has_blocked_you,
+			EXISTS (SELECT 1 FROM follow_requests WHERE user_id = u.id AND requester_id = $2) AS is_follow_requested
 		FROM 
 			users u
-		LEFT JOIN 
-			followers f1 ON f1.follower_id = u.id  -- Counting who the user is following
-		LEFT JOIN 
-			followers f2 ON f2.user_id = u.id     -- Counting followers (those who follow the user)
-		LEFT JOIN posts p ON p.user_id = u.id
-		WHERE u.id = $1
-		GROUP BY 
-			u.id, u.username, u.email, u.bio, u.image_url, u."role", u.last_login_at, u.verified, u.created_at, u.updated_at;
+		WHERE u.id = $1;
 
 	`
 	var currUserId int64 = 0
@@ -189,12 +325,16 @@ func (s *UserStore) GetProfileById(ctx context.Context, userId int64, currUserId
 		&profile.User.Role,
 		&profile.User.LastLoginAt,
 		&profile.User.Verified,
+		&profile.User.IsPrivate,
 		&profile.User.CreatedAt,
 		&profile.User.UpdatedAt,
 		&profile.FollowingCount,
 		&profile.FollowersCount,
 		&profile.PostsCount,
 		&profile.IsFollowed,
+		&profile.IsBlocked,
+		&profile.HasBlockedYou,
+		&profile.IsFollowRequested,
 	)
 	if err != nil {
 		return ProfileData{}, err
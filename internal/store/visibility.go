@@ -0,0 +1,32 @@
+package store
+
+// visiblePostClause returns a predicate hiding the posts (aliased p) whose
+// visibility level doesn't allow the user bound to viewerParam to see them
+func visiblePostClause(viewerParam string) string {
+	return `(
+			p.user_id = ` + viewerParam + `
+			OR p.visibility IN ('public', 'unlisted')
+			OR (p.visibility = 'followers' AND EXISTS (
+				SELECT 1 FROM followers pvf WHERE pvf.user_id = p.user_id AND pvf.follower_id = ` + viewerParam + `
+			))
+		)`
+}
+
+// visibleAuthorClause returns a predicate hiding the posts (aliased p, author
+// aliased u) of private users from everyone but the author and their followers
+func visibleAuthorClause(viewerParam string) string {
+	return `(
+			NOT u.is_private
+			OR p.user_id = ` + viewerParam + `
+			OR EXISTS (SELECT 1 FROM followers vf WHERE vf.user_id = p.user_id AND vf.follower_id = ` + viewerParam + `)
+		)`
+}
+
+// activeAuthorClause hides the posts of suspended or banned authors (aliased u)
+// when hide is set
+func activeAuthorClause(hide bool) string {
+	if !hide {
+		return `TRUE`
+	}
+	return `NOT ` + activeSuspensionClause
+}
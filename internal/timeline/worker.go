@@ -0,0 +1,140 @@
+package timeline
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/shehab910/social/internal/store"
+)
+
+type JobKind int
+
+const (
+	// JobFanOut pushes a newly created post into its author's followers timelines
+	JobFanOut JobKind = iota
+	// JobBackfill copies the latest posts of a newly followed user
+	JobBackfill
+	// JobPrune removes the posts of an unfollowed user
+	JobPrune
+)
+
+type Job struct {
+	Kind       JobKind
+	PostID     int64
+	FollowerID int64
+	FollowedID int64
+}
+
+type Config struct {
+	Workers       int
+	BufferSize    int
+	BackfillLimit int
+	JobTimeout    time.Duration
+}
+
+type FanOutWorker struct {
+	store *store.Storage
+	cfg   Config
+	jobs  chan Job
+	// overflow bounds the jobs processed out of band while the queue is full
+	overflow chan struct{}
+	wg       sync.WaitGroup
+	// mu guards stopped, Enqueue holds it shared so Stop can't close jobs
+	// in the middle of a send
+	mu      sync.RWMutex
+	stopped bool
+}
+
+func NewFanOutWorker(store *store.Storage, cfg Config) *FanOutWorker {
+	return &FanOutWorker{
+		store:    store,
+		cfg:      cfg,
+		jobs:     make(chan Job, cfg.BufferSize),
+		overflow: make(chan struct{}, max(cfg.Workers, 1)),
+	}
+}
+
+func (w *FanOutWorker) Start() {
+	for i := 0; i < w.cfg.Workers; i++ {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for job := range w.jobs {
+				w.process(job)
+			}
+		}()
+	}
+}
+
+// Stop waits for the queued and out of band jobs to finish, the jobs enqueued
+// afterwards are dropped
+func (w *FanOutWorker) Stop() {
+	w.mu.Lock()
+	if w.stopped {
+		w.mu.Unlock()
+		return
+	}
+	w.stopped = true
+	close(w.jobs)
+	w.mu.Unlock()
+
+	w.wg.Wait()
+}
+
+// Enqueue doesn't wait for the job to run. If the queue is full the job is
+// processed out of band so the timelines don't miss entries, only once the
+// out of band slots are taken too it waits for room in the queue
+func (w *FanOutWorker) Enqueue(job Job) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.stopped {
+		log.Warn().Int("kind", int(job.Kind)).Msg("fan-out worker is stopped, dropping job")
+		return
+	}
+
+	select {
+	case w.jobs <- job:
+		return
+	default:
+	}
+
+	select {
+	case w.jobs <- job:
+	case w.overflow <- struct{}{}:
+		log.Warn().Int("kind", int(job.Kind)).Msg("fan-out queue is full, processing job out of band")
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			defer func() { <-w.overflow }()
+			w.process(job)
+		}()
+	}
+}
+
+func (w *FanOutWorker) process(job Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), w.cfg.JobTimeout)
+	defer cancel()
+
+	var err error
+	switch job.Kind {
+	case JobFanOut:
+		err = w.store.Timelines.FanOut(ctx, job.PostID)
+	case JobBackfill:
+		err = w.store.Timelines.Backfill(ctx, job.FollowerID, job.FollowedID, w.cfg.BackfillLimit)
+	case JobPrune:
+		err = w.store.Timelines.Prune(ctx, job.FollowerID, job.FollowedID)
+	}
+
+	if err != nil {
+		log.Error().
+			Err(err).
+			Int("kind", int(job.Kind)).
+			Int64("postId", job.PostID).
+			Int64("followerId", job.FollowerID).
+			Int64("followedId", job.FollowedID).
+			Msg("fan-out job failed")
+	}
+}
@@ -1,6 +1,6 @@
 import { useQuery } from "@tanstack/react-query";
 import { apiClient } from "@/lib/api-client";
-import { Post, PaginatedFeedQuery, Envelope } from "@/types";
+import { Post, PaginatedFeedQuery, Envelope, CursorPage } from "@/types";
 import { useMutation, useQueryClient } from "@tanstack/react-query";
 import axios, { type AxiosError } from "axios";
 import { authErrorToast } from "@/utils/toast";
@@ -56,10 +56,11 @@ export const useUserFeed = (query: PaginatedFeedQuery) => {
     queryFn: async () => {
       const queryString = buildFeedQueryString(query);
 
-      const { data } = await apiClient.get<Envelope<Post[]>>(
+      // the feed is paged by cursor, only its first page is shown for now
+      const { data } = await apiClient.get<Envelope<CursorPage<Post>>>(
         `/users/feed?${queryString}`
       );
-      return data;
+      return { data: data.data.items } as Envelope<Post[]>;
     },
   });
 };
@@ -2,6 +2,11 @@ export type Envelope<T> = {
   data: T;
 };
 
+export type CursorPage<T> = {
+  items: T[];
+  next_cursor?: string;
+};
+
 export type User = {
   id: number;
   username: string;